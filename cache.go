@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errNotModified is returned by fetches answered with 304 Not Modified
+var errNotModified = errors.New("not modified")
+
+// CacheEntry holds the HTTP validators of a URL fetched for a source
+type CacheEntry struct {
+	SourceID     string    `db:"source_id" json:"-"`
+	URL          string    `db:"url" json:"url"`
+	ETag         string    `db:"etag" json:"etag,omitempty"`
+	LastModified string    `db:"last_modified" json:"last_modified,omitempty"`
+	CheckedAt    time.Time `db:"checked_at" json:"checked_at"`
+	ChangedAt    time.Time `db:"changed_at" json:"changed_at"`
+}
+
+// FetchCache lets the fetches of a run send conditional requests. Updated
+// validators are only persisted once the fetched content has been indexed.
+type FetchCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+	touched map[string]bool
+}
+
+func newFetchCache(entries []CacheEntry) *FetchCache {
+	c := &FetchCache{entries: map[string]CacheEntry{}, touched: map[string]bool{}}
+	for _, entry := range entries {
+		c.entries[entry.URL] = entry
+	}
+	return c
+}
+
+// addConditions sets If-None-Match and If-Modified-Since from the cached
+// validators of the request URL
+func (c *FetchCache) addConditions(req *http.Request) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[req.URL.String()]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// record updates the cached validators of a URL from a 200 or 304 response
+func (c *FetchCache) record(url string, resp *http.Response) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entry := c.entries[url]
+	entry.URL = url
+	entry.CheckedAt = now
+	if resp.StatusCode != http.StatusNotModified {
+		entry.ETag = resp.Header.Get("ETag")
+		entry.LastModified = resp.Header.Get("Last-Modified")
+		entry.ChangedAt = now
+	}
+	c.entries[url] = entry
+	c.touched[url] = true
+}
+
+// touchedEntries returns the entries updated during the run
+func (c *FetchCache) touchedEntries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, len(c.touched))
+	for url := range c.touched {
+		entries = append(entries, c.entries[url])
+	}
+	return entries
+}
+
+// loadFetchCache loads the cached validators of a source
+func (i *Ingester) loadFetchCache(ctx context.Context, sourceID string) (*FetchCache, error) {
+	entries, err := i.cacheEntries(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	return newFetchCache(entries), nil
+}
+
+// cacheEntries returns the cache entries of the given sources
+func (i *Ingester) cacheEntries(ctx context.Context, sourceIDs ...string) ([]CacheEntry, error) {
+	query := `
+		SELECT source_id, url, etag, last_modified, checked_at, changed_at
+		FROM http_cache
+		WHERE source_id = ANY($1)
+		ORDER BY url`
+
+	entries := []CacheEntry{}
+	if err := i.db.SelectContext(ctx, &entries, query, pq.StringArray(sourceIDs)); err != nil {
+		return nil, fmt.Errorf("failed to get cache entries: %w", err)
+	}
+	return entries, nil
+}
+
+// saveFetchCache persists the validators updated during a run
+func (i *Ingester) saveFetchCache(ctx context.Context, sourceID string, cache *FetchCache) error {
+	query := `
+		INSERT INTO http_cache (source_id, url, etag, last_modified, checked_at, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (source_id, url) DO UPDATE
+		SET etag = EXCLUDED.etag,
+			last_modified = EXCLUDED.last_modified,
+			checked_at = EXCLUDED.checked_at,
+			changed_at = EXCLUDED.changed_at`
+
+	for _, entry := range cache.touchedEntries() {
+		_, err := i.db.ExecContext(ctx, query, sourceID, entry.URL, entry.ETag, entry.LastModified, entry.CheckedAt, entry.ChangedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save cache entry for %s: %w", entry.URL, err)
+		}
+	}
+	return nil
+}
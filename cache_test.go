@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchCacheConditions(t *testing.T) {
+	cache := newFetchCache([]CacheEntry{
+		{URL: "https://example.com/etag", ETag: `"v1"`},
+		{URL: "https://example.com/modified", LastModified: "Mon, 01 Jan 2024 00:00:00 GMT"},
+		{URL: "https://example.com/both", ETag: `W/"v2"`, LastModified: "Tue, 02 Jan 2024 00:00:00 GMT"},
+	})
+
+	tests := []struct {
+		cache        *FetchCache
+		url          string
+		etag         string
+		lastModified string
+	}{
+		{cache, "https://example.com/etag", `"v1"`, ""},
+		{cache, "https://example.com/modified", "", "Mon, 01 Jan 2024 00:00:00 GMT"},
+		{cache, "https://example.com/both", `W/"v2"`, "Tue, 02 Jan 2024 00:00:00 GMT"},
+		{cache, "https://example.com/unknown", "", ""},
+		{nil, "https://example.com/etag", "", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		tt.cache.addConditions(req)
+		if etag, modified := req.Header.Get("If-None-Match"), req.Header.Get("If-Modified-Since"); etag != tt.etag || modified != tt.lastModified {
+			t.Errorf("%s: If-None-Match %q, If-Modified-Since %q; want %q, %q", tt.url, etag, modified, tt.etag, tt.lastModified)
+		}
+	}
+}
+
+func TestGetURLNotModified(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+	var conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	cache := newFetchCache(nil)
+	resp, err := getURL(context.Background(), server.Client(), server.URL+"/page", cache)
+	if err != nil {
+		t.Fatalf("first fetch failed: %v", err)
+	}
+	resp.Body.Close()
+
+	entries := cache.touchedEntries()
+	if len(entries) != 1 || entries[0].ETag != etag || entries[0].LastModified != lastModified || entries[0].ChangedAt.IsZero() {
+		t.Fatalf("entries after the first fetch = %+v, want the validators of the page", entries)
+	}
+	changedAt := entries[0].ChangedAt
+
+	// The validators make the next fetch conditional
+	if _, err := getURL(context.Background(), server.Client(), server.URL+"/page", cache); !errors.Is(err, errNotModified) {
+		t.Fatalf("second fetch err = %v, want errNotModified", err)
+	}
+	if conditional != 1 {
+		t.Errorf("server saw %d conditional requests, want 1", conditional)
+	}
+	entry := cache.touchedEntries()[0]
+	if entry.ETag != etag || !entry.ChangedAt.Equal(changedAt) || entry.CheckedAt.Before(changedAt) {
+		t.Errorf("entry after 304 = %+v, want the validators and change time kept", entry)
+	}
+
+	// Failed fetches leave the cache alone
+	if _, err := getURL(context.Background(), server.Client(), server.URL+"/broken", cache); err == nil || errors.Is(err, errNotModified) {
+		t.Errorf("err = %v, want a status error", err)
+	}
+	if entries := cache.touchedEntries(); len(entries) != 1 {
+		t.Errorf("got %d touched entries, want only the page", len(entries))
+	}
+
+	// Without a cache requests are never conditional
+	resp, err = getURL(context.Background(), server.Client(), server.URL+"/page", nil)
+	if err != nil {
+		t.Fatalf("uncached fetch failed: %v", err)
+	}
+	resp.Body.Close()
+	if conditional != 1 {
+		t.Error("an uncached fetch should not be conditional")
+	}
+}
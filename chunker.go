@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+// Chunking strategies
+const (
+	ChunkStrategyFixed    = "fixed"
+	ChunkStrategySentence = "sentence"
+	ChunkStrategyMarkdown = "markdown"
+)
+
+// Global chunker used by the ingestion pipeline
+var chunker Chunker
+
+// Chunk is a passage of a document. Start and End are character offsets
+// into the original text, so Text == string([]rune(text)[Start:End]).
+type Chunk struct {
+	Index   int
+	Text    string
+	Start   int
+	End     int
+	Heading string
+}
+
+// Chunker splits document text into chunks small enough to embed
+type Chunker interface {
+	Split(text string) []Chunk
+}
+
+// NewChunker creates the chunker selected by the chunking configuration
+func NewChunker(cfg config.ChunkingConfig) (Chunker, error) {
+	if cfg.Size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive")
+	}
+	if cfg.Overlap < 0 || cfg.Overlap >= cfg.Size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and the chunk size")
+	}
+
+	switch cfg.Strategy {
+	case ChunkStrategyFixed:
+		return &FixedSizeChunker{Size: cfg.Size, Overlap: cfg.Overlap}, nil
+	case ChunkStrategySentence:
+		return &SentenceChunker{Size: cfg.Size, Overlap: cfg.Overlap}, nil
+	case ChunkStrategyMarkdown:
+		return &MarkdownChunker{Size: cfg.Size, Overlap: cfg.Overlap}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunking strategy: %s", cfg.Strategy)
+	}
+}
+
+// span is a half-open range of character offsets
+type span struct {
+	start int
+	end   int
+}
+
+// FixedSizeChunker cuts text into windows of Size characters that overlap
+// by Overlap characters, preferring to break at whitespace
+type FixedSizeChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c *FixedSizeChunker) Split(text string) []Chunk {
+	runes := []rune(text)
+	return buildChunks(runes, fixedSpans(runes, span{0, len(runes)}, c.Size, c.Overlap), "", 0)
+}
+
+// fixedSpans splits a range into overlapping windows of at most size characters
+func fixedSpans(runes []rune, r span, size, overlap int) []span {
+	var spans []span
+	start := r.start
+	for start < r.end {
+		end := start + size
+		if end >= r.end {
+			end = r.end
+		} else if cut := lastSpace(runes, start+size*4/5, end); cut > start {
+			// Avoid cutting words in half when a space is close to the limit
+			end = cut
+		}
+		spans = append(spans, span{start, end})
+
+		if end == r.end {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		} else if cut := nextSpace(runes, next, end); cut > 0 {
+			// Start the overlap at a word boundary
+			next = cut
+		}
+		start = next
+	}
+	return spans
+}
+
+// lastSpace returns the position after the last whitespace in runes[from:to], or -1
+func lastSpace(runes []rune, from, to int) int {
+	for i := to - 1; i >= from; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// nextSpace returns the position after the first whitespace in runes[from:to], or -1
+func nextSpace(runes []rune, from, to int) int {
+	for i := from; i < to; i++ {
+		if unicode.IsSpace(runes[i]) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// SentenceChunker packs whole sentences and paragraphs into chunks of up to
+// Size characters, repeating trailing sentences of up to Overlap characters
+// at the start of the next chunk
+type SentenceChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c *SentenceChunker) Split(text string) []Chunk {
+	runes := []rune(text)
+	spans := packSpans(runes, sentenceSpans(runes, span{0, len(runes)}), c.Size, c.Overlap)
+	return buildChunks(runes, spans, "", 0)
+}
+
+// sentenceSpans splits a range at sentence ends and paragraph breaks
+func sentenceSpans(runes []rune, r span) []span {
+	var spans []span
+	start := r.start
+	for i := r.start; i < r.end; i++ {
+		boundary := false
+		switch runes[i] {
+		case '.', '!', '?':
+			boundary = i+1 == r.end || unicode.IsSpace(runes[i+1])
+		case '\n':
+			boundary = i+1 < r.end && runes[i+1] == '\n'
+		}
+		if boundary {
+			spans = append(spans, span{start, i + 1})
+			start = i + 1
+		}
+	}
+	if start < r.end {
+		spans = append(spans, span{start, r.end})
+	}
+	return spans
+}
+
+// packSpans greedily combines consecutive segments into chunks of at most
+// size characters. Segments longer than size are cut into fixed windows.
+func packSpans(runes []rune, segments []span, size, overlap int) []span {
+	var spans []span
+	first := 0
+	for first < len(segments) {
+		start := segments[first].start
+		last := first
+		for last+1 < len(segments) && segments[last+1].end-start <= size {
+			last++
+		}
+
+		if segments[last].end-start > size {
+			spans = append(spans, fixedSpans(runes, segments[first], size, overlap)...)
+			first++
+			continue
+		}
+		spans = append(spans, span{start, segments[last].end})
+
+		if last+1 == len(segments) {
+			break
+		}
+
+		// Start the next chunk with the trailing segments that fit in the overlap
+		next := last + 1
+		for next-1 > first && segments[last].end-segments[next-1].start <= overlap {
+			next--
+		}
+		// Drop overlap that would leave no room for new text in the next chunk
+		for next <= last && segments[last+1].end-segments[next].start > size {
+			next++
+		}
+		first = next
+	}
+	return spans
+}
+
+// MarkdownChunker splits Markdown at headings and packs each section by
+// sentences, recording the heading that a chunk belongs to
+type MarkdownChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c *MarkdownChunker) Split(text string) []Chunk {
+	runes := []rune(text)
+
+	var chunks []Chunk
+	for _, section := range markdownSections(runes) {
+		spans := packSpans(runes, sentenceSpans(runes, section.span), c.Size, c.Overlap)
+		chunks = append(chunks, buildChunks(runes, spans, section.heading, len(chunks))...)
+	}
+	return chunks
+}
+
+// markdownSection is the text between two headings
+type markdownSection struct {
+	span
+	heading string
+}
+
+// markdownSections splits text at ATX headings outside fenced code blocks
+func markdownSections(runes []rune) []markdownSection {
+	var sections []markdownSection
+	current := markdownSection{}
+	inFence := false
+
+	lineStart := 0
+	for lineStart < len(runes) {
+		lineEnd := lineStart
+		for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+			lineEnd++
+		}
+		line := strings.TrimSpace(string(runes[lineStart:lineEnd]))
+
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+		} else if !inFence && isMarkdownHeading(line) {
+			current.end = lineStart
+			if current.end > current.start {
+				sections = append(sections, current)
+			}
+			current = markdownSection{
+				span:    span{start: lineStart},
+				heading: strings.TrimSpace(strings.TrimLeft(line, "#")),
+			}
+		}
+
+		lineStart = lineEnd + 1
+	}
+
+	current.end = len(runes)
+	if current.end > current.start {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// isMarkdownHeading reports whether a line is an ATX heading such as "## Setup"
+func isMarkdownHeading(line string) bool {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	return level >= 1 && level <= 6 && (level == len(line) || line[level] == ' ')
+}
+
+// buildChunks turns spans into chunks, trimming surrounding whitespace and
+// dropping spans that contain no text
+func buildChunks(runes []rune, spans []span, heading string, firstIndex int) []Chunk {
+	var chunks []Chunk
+	for _, s := range spans {
+		for s.start < s.end && unicode.IsSpace(runes[s.start]) {
+			s.start++
+		}
+		for s.end > s.start && unicode.IsSpace(runes[s.end-1]) {
+			s.end--
+		}
+		if s.start == s.end {
+			continue
+		}
+
+		chunks = append(chunks, Chunk{
+			Index:   firstIndex + len(chunks),
+			Text:    string(runes[s.start:s.end]),
+			Start:   s.start,
+			End:     s.end,
+			Heading: heading,
+		})
+	}
+	return chunks
+}
+
+// CodeChunker splits source code at top-level declarations, keeping the
+// comments above a declaration with it, and packs declarations into chunks
+// of up to Size characters. Each chunk records the first declaration it
+// holds as its heading.
+type CodeChunker struct {
+	Size     int
+	Overlap  int
+	Language string
+}
+
+func (c *CodeChunker) Split(text string) []Chunk {
+	runes := []rune(text)
+	segments, headings := codeSegments(runes, c.Language)
+
+	var chunks []Chunk
+	for _, s := range packSpans(runes, segments, c.Size, c.Overlap) {
+		chunks = append(chunks, buildChunks(runes, []span{s}, headingAt(headings, s), len(chunks))...)
+	}
+	return chunks
+}
+
+// codeHeading is a declaration line and the offset its segment starts at
+type codeHeading struct {
+	start int
+	text  string
+}
+
+// codeSegments splits code into one segment per declaration, or per line
+// for languages without declaration patterns
+func codeSegments(runes []rune, language string) ([]span, []codeHeading) {
+	syntax := codeSyntaxes[language]
+
+	var segments []span
+	var headings []codeHeading
+	start := 0
+	commentStart := -1
+	lineStart := 0
+	for lineStart < len(runes) {
+		lineEnd := lineStart
+		for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+			lineEnd++
+		}
+		line := string(runes[lineStart:lineEnd])
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case syntax.declaration == nil:
+			if lineEnd > start {
+				segments = append(segments, span{start, min(lineEnd+1, len(runes))})
+			}
+			start = min(lineEnd+1, len(runes))
+		case syntax.isDeclaration(line):
+			// Comments directly above a declaration belong to it
+			boundary := lineStart
+			if commentStart >= 0 {
+				boundary = commentStart
+			}
+			if boundary > start {
+				segments = append(segments, span{start, boundary})
+			}
+			start = boundary
+			headings = append(headings, codeHeading{start, strings.TrimSpace(strings.TrimRight(trimmed, "{:"))})
+			commentStart = -1
+		case syntax.isComment(trimmed):
+			if commentStart < 0 {
+				commentStart = lineStart
+			}
+		default:
+			commentStart = -1
+		}
+
+		lineStart = lineEnd + 1
+	}
+	if start < len(runes) {
+		segments = append(segments, span{start, len(runes)})
+	}
+	return segments, headings
+}
+
+// headingAt returns the first declaration starting in a span, or else the
+// declaration the span is part of
+func headingAt(headings []codeHeading, s span) string {
+	heading := ""
+	for _, h := range headings {
+		if h.start >= s.end {
+			break
+		}
+		if h.start >= s.start {
+			return h.text
+		}
+		heading = h.text
+	}
+	return heading
+}
+
+// codeSyntax describes how declarations and comments start in a language
+type codeSyntax struct {
+	declaration *regexp.Regexp
+	// indent is the deepest indentation, in levels, of declarations
+	// worth splitting at, such as methods inside a Java class
+	indent   int
+	comments []string
+}
+
+// isDeclaration reports whether a line starts a declaration
+func (s codeSyntax) isDeclaration(line string) bool {
+	body := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(body)]
+	// Count both two and four spaces as one level
+	levels := strings.Count(indent, "\t") + (strings.Count(indent, " ")+3)/4
+	return levels <= s.indent && s.declaration.MatchString(body)
+}
+
+// isComment reports whether a trimmed line is a comment
+func (s codeSyntax) isComment(line string) bool {
+	for _, prefix := range s.comments {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cComments    = []string{"//", "/*", "*"}
+	hashComments = []string{"#"}
+	codeSyntaxes = map[string]codeSyntax{
+		"go":         {regexp.MustCompile(`^(func|type|var|const)\b`), 0, cComments},
+		"python":     {regexp.MustCompile(`^(async\s+def|def|class)\b`), 1, append(hashComments, "@")},
+		"javascript": {jsDeclaration, 0, cComments},
+		"typescript": {jsDeclaration, 0, cComments},
+		"java":       {jvmDeclaration, 1, append(cComments, "@")},
+		"kotlin":     {jvmDeclaration, 1, append(cComments, "@")},
+		"scala":      {jvmDeclaration, 1, append(cComments, "@")},
+		"csharp":     {jvmDeclaration, 2, append(cComments, "[")},
+		"swift":      {jvmDeclaration, 1, append(cComments, "@")},
+		"php":        {regexp.MustCompile(`^((abstract|final|public|private|protected|static)\s+)*(function|class|interface|trait|enum)\b`), 1, append(cComments, "#")},
+		"rust":       {regexp.MustCompile(`^(pub(\([\w:]+\))?\s+)?((async|const|unsafe|extern)\s+)*(fn|struct|enum|trait|impl|mod|const|static|type|union|macro_rules!)\b`), 1, append(cComments, "#[")},
+		"ruby":       {regexp.MustCompile(`^(def|class|module)\b`), 1, hashComments},
+		"c":          {cDeclaration, 0, cComments},
+		"cpp":        {cDeclaration, 0, cComments},
+		"shell":      {regexp.MustCompile(`^(function\s+[\w-]+|[\w-]+\s*\(\))`), 0, hashComments},
+		"sql":        {regexp.MustCompile(`(?i)^(create|alter|drop|insert|update|delete|select|with)\b`), 0, []string{"--"}},
+	}
+	jsDeclaration  = regexp.MustCompile(`^(export\s+)?(default\s+)?(declare\s+)?(async\s+)?(function\*?|class|const|let|var|interface|type|enum|namespace)\b`)
+	jvmDeclaration = regexp.MustCompile(`^((public|private|protected|internal|static|final|abstract|sealed|open|override|data|async|partial|virtual|inline|suspend)\s+)*(class|interface|enum|record|object|struct|trait|fun|func|def|void|[\w<>\[\],]+\s+\w+\s*\()`)
+	cDeclaration   = regexp.MustCompile(`^((struct|class|namespace|enum|union|typedef|template)\b|[A-Za-z_][\w\s\*&:<>,]*\w[\s\*&]*\()`)
+)
+
+// codeLanguages maps file extensions to the languages CodeChunker knows,
+// plus other text formats that are chunked line by line
+var codeLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".jsx": "javascript", ".mjs": "javascript",
+	".ts": "typescript", ".tsx": "typescript", ".java": "java", ".kt": "kotlin", ".scala": "scala",
+	".cs": "csharp", ".swift": "swift", ".php": "php", ".rs": "rust", ".rb": "ruby",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".sh": "shell", ".bash": "shell", ".sql": "sql",
+	".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".json": "json", ".proto": "protobuf",
+}
+
+// chunkerFor returns the chunker for text in a language: Markdown is split
+// at headings, code at declarations, and anything else by the configured
+// chunker
+func chunkerFor(language string, cfg config.ChunkingConfig) Chunker {
+	switch language {
+	case "":
+		return chunker
+	case "markdown":
+		return &MarkdownChunker{Size: cfg.Size, Overlap: cfg.Overlap}
+	default:
+		return &CodeChunker{Size: cfg.Size, Overlap: cfg.Overlap, Language: language}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+// checkOffsets verifies that every chunk's text is the range it claims to cover
+func checkOffsets(t *testing.T, text string, chunks []Chunk) {
+	t.Helper()
+	runes := []rune(text)
+	for i, chunk := range chunks {
+		if chunk.Index != i {
+			t.Errorf("chunk %d has index %d", i, chunk.Index)
+		}
+		if got := string(runes[chunk.Start:chunk.End]); got != chunk.Text {
+			t.Errorf("chunk %d text %q does not match offsets %d-%d (%q)", i, chunk.Text, chunk.Start, chunk.End, got)
+		}
+	}
+}
+
+func chunkTexts(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+func TestNewChunkerValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ChunkingConfig
+		wantErr bool
+	}{
+		{"sentence", config.ChunkingConfig{Strategy: ChunkStrategySentence, Size: 100, Overlap: 10}, false},
+		{"zero size", config.ChunkingConfig{Strategy: ChunkStrategyFixed, Size: 0}, true},
+		{"overlap as large as size", config.ChunkingConfig{Strategy: ChunkStrategyFixed, Size: 10, Overlap: 10}, true},
+		{"unknown strategy", config.ChunkingConfig{Strategy: "paragraph", Size: 100}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewChunker(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewChunker err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFixedSizeChunkerBreaksAtWords(t *testing.T) {
+	text := "alpha beta gamma delta epsilon zeta eta theta iota kappa"
+	chunks := (&FixedSizeChunker{Size: 20, Overlap: 6}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	for i, chunk := range chunks {
+		if len([]rune(chunk.Text)) > 20 {
+			t.Errorf("chunk %d is %d characters, want at most 20", i, len([]rune(chunk.Text)))
+		}
+		for _, word := range strings.Fields(chunk.Text) {
+			if !strings.Contains(text, " "+word+" ") && !strings.HasPrefix(text, word+" ") && !strings.HasSuffix(text, " "+word) {
+				t.Errorf("chunk %d cuts a word: %q", i, word)
+			}
+		}
+		if i > 0 && chunk.Start > chunks[i-1].End+1 {
+			t.Errorf("text between chunk %d and %d is skipped", i-1, i)
+		}
+	}
+	if chunks[2].Start >= chunks[1].End {
+		t.Errorf("chunk 2 does not overlap chunk 1")
+	}
+	if last := chunks[len(chunks)-1]; last.End != len([]rune(text)) {
+		t.Errorf("last chunk ends at %d, want %d", last.End, len([]rune(text)))
+	}
+}
+
+func TestSentenceChunkerPacksSentences(t *testing.T) {
+	text := "One is short. Two is a bit longer! Three asks why? Four.\n\nNew paragraph here."
+	chunks := (&SentenceChunker{Size: 40, Overlap: 0}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	want := []string{"One is short. Two is a bit longer!", "Three asks why? Four.", "New paragraph here."}
+	if got := chunkTexts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+}
+
+func TestSentenceChunkerOverlap(t *testing.T) {
+	text := "Aaaa aaaa. Bbbb bbbb. Cccc cccc. Dddd dddd."
+	chunks := (&SentenceChunker{Size: 22, Overlap: 11}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	want := []string{"Aaaa aaaa. Bbbb bbbb.", "Bbbb bbbb. Cccc cccc.", "Cccc cccc. Dddd dddd."}
+	if got := chunkTexts(chunks); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+}
+
+func TestSentenceChunkerCutsLongSentences(t *testing.T) {
+	text := strings.Repeat("word ", 30) + "end."
+	chunks := (&SentenceChunker{Size: 50, Overlap: 0}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want the sentence cut into at least 3", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len([]rune(chunk.Text)) > 50 {
+			t.Errorf("chunk %d is %d characters, want at most 50", i, len([]rune(chunk.Text)))
+		}
+	}
+}
+
+func TestMarkdownChunkerSplitsAtHeadings(t *testing.T) {
+	text := `Intro text.
+
+# Setup
+
+Install it.
+
+## Configuration
+
+Edit config.json.
+
+` + "```sh\n# not a heading\nrun it\n```" + `
+
+#hashtag is not a heading either.`
+
+	chunks := (&MarkdownChunker{Size: 200, Overlap: 0}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	wantHeadings := []string{"", "Setup", "Configuration"}
+	if len(chunks) != len(wantHeadings) {
+		t.Fatalf("got %d chunks %q, want %d", len(chunks), chunkTexts(chunks), len(wantHeadings))
+	}
+	for i, want := range wantHeadings {
+		if chunks[i].Heading != want {
+			t.Errorf("chunk %d heading = %q, want %q", i, chunks[i].Heading, want)
+		}
+	}
+	if !strings.Contains(chunks[2].Text, "# not a heading") || !strings.HasSuffix(chunks[2].Text, "either.") {
+		t.Errorf("fenced code and hashtags should stay in the last section, got %q", chunks[2].Text)
+	}
+}
+
+const goSource = `package cache
+
+import "sync"
+
+// Cache keeps recently used entries in memory.
+// It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+// Get returns the entry for a key.
+func (c *Cache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+func (c *Cache) Set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+}
+`
+
+func TestCodeChunkerSplitsAtDeclarations(t *testing.T) {
+	chunks := (&CodeChunker{Size: 200, Language: "go"}).Split(goSource)
+	checkOffsets(t, goSource, chunks)
+
+	// The package clause is small enough to share the first chunk
+	wantHeadings := []string{"type Cache struct", "func (c *Cache) Get(key string) (string, bool)", "func (c *Cache) Set(key, value string)"}
+	if len(chunks) != len(wantHeadings) {
+		t.Fatalf("got %d chunks %q, want %d", len(chunks), chunkTexts(chunks), len(wantHeadings))
+	}
+	for i, want := range wantHeadings {
+		if chunks[i].Heading != want {
+			t.Errorf("chunk %d heading = %q, want %q", i, chunks[i].Heading, want)
+		}
+	}
+	if !strings.Contains(chunks[0].Text, "\n\n// Cache keeps") || !strings.HasPrefix(chunks[1].Text, "// Get returns") {
+		t.Errorf("doc comments should stay with their declarations, got %q", chunkTexts(chunks))
+	}
+}
+
+func TestCodeChunkerPacksSmallDeclarations(t *testing.T) {
+	chunks := (&CodeChunker{Size: 1000, Language: "go"}).Split(goSource)
+	if len(chunks) != 1 || chunks[0].Text != strings.TrimSpace(goSource) {
+		t.Fatalf("got %d chunks, want the whole file in one", len(chunks))
+	}
+	if chunks[0].Heading != "type Cache struct" {
+		t.Errorf("heading = %q, want the first declaration", chunks[0].Heading)
+	}
+}
+
+func TestCodeChunkerPythonMethods(t *testing.T) {
+	text := `import os
+
+
+class Store:
+    """Keeps files."""
+
+    def read(self, name):
+        return open(os.path.join(self.root, name)).read()
+
+    @property
+    def size(self):
+        return len(os.listdir(self.root))
+`
+	chunks := (&CodeChunker{Size: 120, Language: "python"}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	var headings []string
+	for _, chunk := range chunks {
+		headings = append(headings, chunk.Heading)
+	}
+	want := []string{"class Store", "def read(self, name)", "def size(self)"}
+	if strings.Join(headings, "|") != strings.Join(want, "|") {
+		t.Errorf("headings = %q, want %q", headings, want)
+	}
+	if last := chunks[len(chunks)-1].Text; !strings.HasPrefix(strings.TrimSpace(last), "@property") {
+		t.Errorf("decorators should stay with their method, got %q", last)
+	}
+}
+
+func TestCodeChunkerCutsLongDeclarations(t *testing.T) {
+	text := "func long() {\n" + strings.Repeat("\tcall()\n", 50) + "}\n"
+	chunks := (&CodeChunker{Size: 100, Overlap: 10, Language: "go"}).Split(text)
+	checkOffsets(t, text, chunks)
+
+	if len(chunks) < 4 {
+		t.Fatalf("got %d chunks, want the declaration cut into windows", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len([]rune(chunk.Text)) > 100 {
+			t.Errorf("chunk %d is %d characters, want at most 100", i, len([]rune(chunk.Text)))
+		}
+		if chunk.Heading != "func long()" {
+			t.Errorf("chunk %d heading = %q, want the declaration it is part of", i, chunk.Heading)
+		}
+	}
+}
+
+func TestChunkerFor(t *testing.T) {
+	cfg := config.ChunkingConfig{Size: 500, Overlap: 50}
+	if _, ok := chunkerFor("markdown", cfg).(*MarkdownChunker); !ok {
+		t.Error("markdown should use the MarkdownChunker")
+	}
+	if c, ok := chunkerFor("rust", cfg).(*CodeChunker); !ok || c.Language != "rust" || c.Size != 500 {
+		t.Errorf("rust should use a CodeChunker, got %#v", chunkerFor("rust", cfg))
+	}
+	if chunkerFor("", cfg) != chunker {
+		t.Error("text without a language should use the configured chunker")
+	}
+}
+
+func TestChunkersSkipBlankText(t *testing.T) {
+	chunkers := []Chunker{
+		&FixedSizeChunker{Size: 10},
+		&SentenceChunker{Size: 10},
+		&MarkdownChunker{Size: 10},
+		&CodeChunker{Size: 10, Language: "go"},
+	}
+	for _, c := range chunkers {
+		if chunks := c.Split(" \n\n \t"); len(chunks) != 0 {
+			t.Errorf("%T returned %d chunks for blank text", c, len(chunks))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// snippetLength is the maximum length of a source snippet in characters
+const snippetLength = 200
+
+// SourceRef describes a numbered context document given to the model and
+// whether the answer cited it
+type SourceRef struct {
+	Index      int     `json:"index"`
+	DocID      string  `json:"doc_id"`
+	Title      string  `json:"title,omitempty"`
+	URL        string  `json:"url,omitempty"`
+	Location   string  `json:"location,omitempty"`
+	Snippet    string  `json:"snippet"`
+	Score      float64 `json:"score"`
+	Similarity float64 `json:"similarity,omitempty"`
+	Cited      bool    `json:"cited"`
+}
+
+// citationPattern matches citations such as [1] or [2, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// parseCitations returns the context numbers cited in a response, ignoring
+// numbers outside 1..count
+func parseCitations(response string, count int) map[int]bool {
+	cited := map[int]bool{}
+	for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err == nil && n >= 1 && n <= count {
+				cited[n] = true
+			}
+		}
+	}
+	return cited
+}
+
+// buildSources describes the context documents, numbered as in the prompt,
+// and marks the ones cited in the response
+func buildSources(docs []Document, response string) []SourceRef {
+	cited := parseCitations(response, len(docs))
+
+	sources := make([]SourceRef, 0, len(docs))
+	for i, doc := range docs {
+		sources = append(sources, SourceRef{
+			Index:      i + 1,
+			DocID:      doc.DocID,
+			Title:      doc.Title,
+			URL:        doc.URL,
+			Location:   doc.location(),
+			Snippet:    snippet(doc.Content),
+			Score:      doc.Score,
+			Similarity: doc.Similarity,
+			Cited:      cited[i+1],
+		})
+	}
+	return sources
+}
+
+// snippet shortens text to snippetLength characters on a word boundary
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+
+	cut := snippetLength
+	for cut > snippetLength/2 && runes[cut] != ' ' {
+		cut--
+	}
+	return string(runes[:cut]) + "..."
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCitations(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     map[int]bool
+	}{
+		{"single", "Paris is the capital [1].", map[int]bool{1: true}},
+		{"adjacent", "It rains often [2][3].", map[int]bool{2: true, 3: true}},
+		{"comma separated", "Both agree [1, 3].", map[int]bool{1: true, 3: true}},
+		{"out of range", "See [0] and [4] and [2].", map[int]bool{2: true}},
+		{"not citations", "Use arr[i] or [a, b] or [1-2].", map[int]bool{}},
+		{"none", "No sources used.", map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCitations(tt.response, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCitations(%q) = %v, want %v", tt.response, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSourcesMarksCitedDocuments(t *testing.T) {
+	docs := []Document{
+		{DocID: "a", Title: "A", Content: "first", Score: 0.9},
+		{DocID: "b", Title: "B", Content: "second", Score: 0.5},
+	}
+
+	sources := buildSources(docs, "Only the second one matters [2].")
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources, want 2", len(sources))
+	}
+	if sources[0].Index != 1 || sources[0].Cited {
+		t.Errorf("source 1 = %+v, want index 1 and not cited", sources[0])
+	}
+	if sources[1].Index != 2 || !sources[1].Cited || sources[1].DocID != "b" || sources[1].Snippet != "second" {
+		t.Errorf("source 2 = %+v, want cited document b", sources[1])
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	if got := snippet("  short\n\ntext "); got != "short text" {
+		t.Errorf("snippet = %q, want whitespace collapsed", got)
+	}
+
+	long := strings.Repeat("word ", 100)
+	got := snippet(long)
+	if !strings.HasSuffix(got, "word...") {
+		t.Errorf("snippet = %q, want it cut on a word boundary", got)
+	}
+	if len([]rune(got)) > snippetLength+3 {
+		t.Errorf("snippet is %d characters, want at most %d", len([]rune(got)), snippetLength+3)
+	}
+}
@@ -8,13 +8,15 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Cache    CacheConfig    `json:"cache"`
-	AI       AIConfig       `json:"ai"`
-	YouTube  YouTubeConfig  `json:"youtube"`
-	Sources  SourcesConfig  `json:"sources"`
-	Logger   LoggerConfig   `json:"logger"`
+	Server    ServerConfig    `json:"server"`
+	Database  DatabaseConfig  `json:"database"`
+	Cache     CacheConfig     `json:"cache"`
+	AI        AIConfig        `json:"ai"`
+	YouTube   YouTubeConfig   `json:"youtube"`
+	Sources   SourcesConfig   `json:"sources"`
+	Chunking  ChunkingConfig  `json:"chunking"`
+	Retrieval RetrievalConfig `json:"retrieval"`
+	Logger    LoggerConfig    `json:"logger"`
 }
 
 type ServerConfig struct {
@@ -58,17 +60,21 @@ type CacheConfig struct {
 }
 
 type AIConfig struct {
-	Model          string   `json:"model"`
-	APIKey         string   `json:"apiKey"`
-	MaxTokens      int      `json:"maxTokens"`
-	Temperature    float64  `json:"temperature"`
-	EmbeddingModel string   `json:"embeddingModel"`
-	EmbeddingDim   int      `json:"embeddingDim"`
-	BatchSize      int      `json:"batchSize"`
-	RequestTimeout Duration `json:"requestTimeout"`
-	EnableRetries  bool     `json:"enableRetries"`
-	MaxRetries     int      `json:"maxRetries"`
-	RetryDelay     Duration `json:"retryDelay"`
+	Provider                string   `json:"provider"`
+	BaseURL                 string   `json:"baseURL"`
+	Model                   string   `json:"model"`
+	APIKey                  string   `json:"apiKey"`
+	MaxTokens               int      `json:"maxTokens"`
+	Temperature             float64  `json:"temperature"`
+	EmbeddingModel          string   `json:"embeddingModel"`
+	EmbeddingDim            int      `json:"embeddingDim"`
+	BatchSize               int      `json:"batchSize"`
+	RequestTimeout          Duration `json:"requestTimeout"`
+	EnableRetries           bool     `json:"enableRetries"`
+	MaxRetries              int      `json:"maxRetries"`
+	RetryDelay              Duration `json:"retryDelay"`
+	HistoryTokenBudget      int      `json:"historyTokenBudget"`
+	MaxConcurrentEmbeddings int      `json:"maxConcurrentEmbeddings"`
 }
 
 type YouTubeConfig struct {
@@ -78,18 +84,51 @@ type YouTubeConfig struct {
 	EnableCache    bool     `json:"enableCache"`
 	CacheDuration  Duration `json:"cacheDuration"`
 	RequestTimeout Duration `json:"requestTimeout"`
+	BaseURL        string   `json:"baseURL"`      // Data API endpoint, empty for Google's
+	TimedTextURL   string   `json:"timedTextURL"` // caption track endpoint
+	Languages      []string `json:"languages"`    // caption languages in order of preference
 }
 
 type SourcesConfig struct {
-	DefaultSchedule   string   `json:"defaultSchedule"`
-	MaxSourcesPerUser int      `json:"maxSourcesPerUser"`
-	UpdateInterval    Duration `json:"updateInterval"`
-	MaxRetries        int      `json:"maxRetries"`
-	RetryDelay        Duration `json:"retryDelay"`
-	TimeoutDuration   Duration `json:"timeoutDuration"`
-	MaxConcurrent     int      `json:"maxConcurrent"`
-	CleanupInterval   Duration `json:"cleanupInterval"`
-	RetentionPeriod   Duration `json:"retentionPeriod"`
+	DefaultSchedule        string   `json:"defaultSchedule"`
+	MaxSourcesPerUser      int      `json:"maxSourcesPerUser"`
+	UpdateInterval         Duration `json:"updateInterval"`
+	MaxRetries             int      `json:"maxRetries"`
+	RetryDelay             Duration `json:"retryDelay"`
+	TimeoutDuration        Duration `json:"timeoutDuration"`
+	MaxConcurrent          int      `json:"maxConcurrent"`
+	CleanupInterval        Duration `json:"cleanupInterval"`
+	RetentionPeriod        Duration `json:"retentionPeriod"`
+	MaxConsecutiveFailures int      `json:"maxConsecutiveFailures"` // 0 never dead-letters
+	MaxPerHost             int      `json:"maxPerHost"`
+	HostDelay              Duration `json:"hostDelay"`
+	GitDir                 string   `json:"gitDir"`       // where git sources are mirrored
+	AllowedPaths           []string `json:"allowedPaths"` // directories local sources may read, none when empty
+}
+
+type ChunkingConfig struct {
+	Strategy string `json:"strategy"`
+	Size     int    `json:"size"`
+	Overlap  int    `json:"overlap"`
+}
+
+type RetrievalConfig struct {
+	Mode                string       `json:"mode"`
+	TopK                int          `json:"topK"`
+	SimilarityThreshold float64      `json:"similarityThreshold"`
+	RRFK                int          `json:"rrfK"`
+	VectorWeight        float64      `json:"vectorWeight"`
+	KeywordWeight       float64      `json:"keywordWeight"`
+	Rerank              RerankConfig `json:"rerank"`
+}
+
+type RerankConfig struct {
+	Enabled            bool    `json:"enabled"`
+	Method             string  `json:"method"`
+	Candidates         int     `json:"candidates"`
+	TopN               int     `json:"topN"`
+	MMRLambda          float64 `json:"mmrLambda"`
+	DuplicateThreshold float64 `json:"duplicateThreshold"`
 }
 
 type LoggerConfig struct {
@@ -170,15 +209,19 @@ var defaults = Config{
 		EnableCache: true,
 	},
 	AI: AIConfig{
-		Model:          "gpt-3.5-turbo",
-		MaxTokens:      2000,
-		Temperature:    0.7,
-		EmbeddingModel: "text-embedding-ada-002",
-		EmbeddingDim:   1536,
-		BatchSize:      32,
-		RequestTimeout: Duration(30 * time.Second),
-		MaxRetries:     3,
-		RetryDelay:     Duration(1 * time.Second),
+		Provider:                "ollama",
+		BaseURL:                 "http://localhost:11434/api",
+		Model:                   "gpt-3.5-turbo",
+		MaxTokens:               2000,
+		Temperature:             0.7,
+		EmbeddingModel:          "nomic-embed-text",
+		EmbeddingDim:            768,
+		BatchSize:               32,
+		RequestTimeout:          Duration(30 * time.Second),
+		MaxRetries:              3,
+		RetryDelay:              Duration(1 * time.Second),
+		HistoryTokenBudget:      1000,
+		MaxConcurrentEmbeddings: 4,
 	},
 	YouTube: YouTubeConfig{
 		MaxResults:     50,
@@ -186,17 +229,44 @@ var defaults = Config{
 		EnableCache:    true,
 		CacheDuration:  Duration(24 * time.Hour),
 		RequestTimeout: Duration(10 * time.Second),
+		TimedTextURL:   "https://www.youtube.com/api/timedtext",
+		Languages:      []string{"en"},
 	},
 	Sources: SourcesConfig{
-		DefaultSchedule:   "0 */6 * * *", // Every 6 hours
-		MaxSourcesPerUser: 100,
-		UpdateInterval:    Duration(15 * time.Minute),
-		MaxRetries:        3,
-		RetryDelay:        Duration(5 * time.Second),
-		TimeoutDuration:   Duration(1 * time.Minute),
-		MaxConcurrent:     5,
-		CleanupInterval:   Duration(24 * time.Hour),
-		RetentionPeriod:   Duration(30 * 24 * time.Hour), // 30 days
+		DefaultSchedule:        "0 */6 * * *", // Every 6 hours
+		MaxSourcesPerUser:      100,
+		UpdateInterval:         Duration(15 * time.Minute),
+		MaxRetries:             3,
+		RetryDelay:             Duration(5 * time.Second),
+		TimeoutDuration:        Duration(1 * time.Minute),
+		MaxConcurrent:          5,
+		CleanupInterval:        Duration(24 * time.Hour),
+		RetentionPeriod:        Duration(30 * 24 * time.Hour), // 30 days
+		MaxConsecutiveFailures: 5,
+		MaxPerHost:             2,
+		HostDelay:              Duration(1 * time.Second),
+		GitDir:                 "data/git",
+	},
+	Chunking: ChunkingConfig{
+		Strategy: "sentence",
+		Size:     1000, // characters
+		Overlap:  150,
+	},
+	Retrieval: RetrievalConfig{
+		Mode:                "hybrid",
+		TopK:                10,
+		SimilarityThreshold: 0.5,
+		RRFK:                60,
+		VectorWeight:        1.0,
+		KeywordWeight:       1.0,
+		Rerank: RerankConfig{
+			Enabled:            false,
+			Method:             "lexical",
+			Candidates:         30,
+			TopN:               5,
+			MMRLambda:          0.7,
+			DuplicateThreshold: 0.95,
+		},
 	},
 	Logger: LoggerConfig{
 		Level:         "info",
@@ -261,6 +331,9 @@ func (c *Config) loadFromEnv() {
 	if aiKey := os.Getenv("AI_API_KEY"); aiKey != "" {
 		c.AI.APIKey = aiKey
 	}
+	if aiURL := os.Getenv("AI_BASE_URL"); aiURL != "" {
+		c.AI.BaseURL = aiURL
+	}
 
 	if ytKey := os.Getenv("YOUTUBE_API_KEY"); ytKey != "" {
 		c.YouTube.APIKey = ytKey
@@ -272,8 +345,30 @@ func (c *Config) validate() error {
 	if c.Database.User == "" || c.Database.Password == "" {
 		return fmt.Errorf("database credentials not provided")
 	}
-	if c.AI.APIKey == "" {
-		return fmt.Errorf("AI API key not provided")
+	switch c.AI.Provider {
+	case "ollama", "openai":
+	default:
+		return fmt.Errorf("unknown AI provider %q", c.AI.Provider)
+	}
+	if c.AI.BaseURL == "" {
+		return fmt.Errorf("AI base URL not provided")
+	}
+	if c.AI.EmbeddingModel == "" {
+		return fmt.Errorf("embedding model not provided")
+	}
+	if c.AI.EmbeddingDim <= 0 {
+		return fmt.Errorf("embedding dimension must be positive")
+	}
+	switch c.Retrieval.Mode {
+	case "vector", "keyword", "hybrid":
+	default:
+		return fmt.Errorf("unknown retrieval mode %q", c.Retrieval.Mode)
+	}
+	if c.Retrieval.TopK <= 0 {
+		return fmt.Errorf("retrieval topK must be positive")
+	}
+	if c.Retrieval.Rerank.Enabled && (c.Retrieval.Rerank.TopN <= 0 || c.Retrieval.Rerank.Candidates < c.Retrieval.Rerank.TopN) {
+		return fmt.Errorf("rerank topN must be positive and no larger than candidates")
 	}
 	if c.YouTube.APIKey == "" {
 		return fmt.Errorf("YouTube API key not provided")
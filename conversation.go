@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message roles
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// conversationTitleLength is the maximum length of a generated conversation title
+const conversationTitleLength = 60
+
+// Conversation represents a multi-turn chat session
+type Conversation struct {
+	ID        string    `db:"id" json:"id"`
+	Title     string    `db:"title" json:"title"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	Messages  []Message `db:"-" json:"messages,omitempty"`
+}
+
+// Message represents a single turn in a conversation
+type Message struct {
+	ID             int       `db:"id" json:"id"`
+	ConversationID string    `db:"conversation_id" json:"conversation_id"`
+	Role           string    `db:"role" json:"role"`
+	Content        string    `db:"content" json:"content"`
+	Sources        JSONB     `db:"sources" json:"sources,omitempty"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+// newConversation returns a conversation that is not stored until its first
+// exchange is saved
+func newConversation(title string) *Conversation {
+	return &Conversation{
+		ID:    fmt.Sprintf("conv-%d", time.Now().UnixNano()),
+		Title: title,
+	}
+}
+
+// GetConversation retrieves a conversation by its ID
+func (db *DB) GetConversation(ctx context.Context, convID string) (*Conversation, error) {
+	query := `
+		SELECT id, title, created_at, updated_at
+		FROM conversations
+		WHERE id = $1`
+
+	var conv Conversation
+	if err := db.Sdb.GetContext(ctx, &conv, query, convID); err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	return &conv, nil
+}
+
+// ListConversations returns conversations ordered by most recent activity
+func (db *DB) ListConversations(ctx context.Context, limit, offset int) ([]Conversation, error) {
+	query := `
+		SELECT id, title, created_at, updated_at
+		FROM conversations
+		ORDER BY updated_at DESC
+		LIMIT $1 OFFSET $2`
+
+	conversations := []Conversation{}
+	if err := db.Sdb.SelectContext(ctx, &conversations, query, limit, offset); err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// RenameConversation changes the title of a conversation
+func (db *DB) RenameConversation(ctx context.Context, convID, title string) (*Conversation, error) {
+	query := `
+		UPDATE conversations
+		SET title = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING id, title, created_at, updated_at`
+
+	var conv Conversation
+	if err := db.Sdb.GetContext(ctx, &conv, query, convID, title); err != nil {
+		return nil, fmt.Errorf("failed to rename conversation: %w", err)
+	}
+
+	return &conv, nil
+}
+
+// DeleteConversation removes a conversation together with its messages
+func (db *DB) DeleteConversation(ctx context.Context, convID string) error {
+	result, err := db.Sdb.ExecContext(ctx, `DELETE FROM conversations WHERE id = $1`, convID)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get deleted count: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete conversation: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// SaveExchange stores a question and its answer in one transaction, creating
+// the conversation if this is its first exchange and bumping its activity time
+func (db *DB) SaveExchange(ctx context.Context, conv *Conversation, query, response string, sources interface{}) error {
+	sourcesJSON, err := json.Marshal(sources)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message sources: %w", err)
+	}
+
+	tx, err := db.Sdb.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO conversations (id, title, created_at, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET updated_at = CURRENT_TIMESTAMP`, conv.ID, conv.Title); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	insert := `
+		INSERT INTO conversation_messages (conversation_id, role, content, sources, created_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+
+	if _, err := tx.ExecContext(ctx, insert, conv.ID, MessageRoleUser, query, JSONB("[]")); err != nil {
+		return fmt.Errorf("failed to insert user message: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, insert, conv.ID, MessageRoleAssistant, response, JSONB(sourcesJSON)); err != nil {
+		return fmt.Errorf("failed to insert assistant message: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetMessages returns all messages of a conversation in chronological order
+func (db *DB) GetMessages(ctx context.Context, convID string) ([]Message, error) {
+	query := `
+		SELECT id, conversation_id, role, content, sources, created_at
+		FROM conversation_messages
+		WHERE conversation_id = $1
+		ORDER BY created_at, id`
+
+	messages := []Message{}
+	if err := db.Sdb.SelectContext(ctx, &messages, query, convID); err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// conversationTitle derives a conversation title from its first question
+func conversationTitle(query string) string {
+	title := strings.Join(strings.Fields(query), " ")
+	if runes := []rune(title); len(runes) > conversationTitleLength {
+		title = string(runes[:conversationTitleLength]) + "..."
+	}
+	return title
+}
+
+// estimateTokens gives a rough token count, assuming ~4 characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// trimHistory keeps the most recent messages that fit within the token budget
+func trimHistory(history []Message, budget int) []Message {
+	used := 0
+	start := len(history)
+	for start > 0 {
+		cost := estimateTokens(history[start-1].Content)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	return history[start:]
+}
+
+// retrievalQuery prefixes the query with the previous user turn so that
+// follow-up questions retrieve context about what they refer to
+func retrievalQuery(history []Message, query string) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == MessageRoleUser {
+			return history[i].Content + "\n" + query
+		}
+	}
+	return query
+}
+
+// loadConversation returns the conversation for a chat request together with
+// its prior messages. Without an ID a new conversation is started; it is only
+// stored once its first exchange is saved.
+func loadConversation(ctx context.Context, req ChatRequest) (*Conversation, []Message, error) {
+	if req.ConversationID == "" {
+		return newConversation(conversationTitle(req.Query)), nil, nil
+	}
+
+	conv, err := db.GetConversation(ctx, req.ConversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, err := db.GetMessages(ctx, conv.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conv, trimHistory(history, db.cfg.AI.HistoryTokenBudget), nil
+}
+
+// saveExchange persists a question and its answer to the conversation
+func saveExchange(ctx context.Context, conv *Conversation, query, response string, sources interface{}) {
+	if err := db.SaveExchange(ctx, conv, query, response, sources); err != nil {
+		log.Printf("Error saving exchange to %s: %v", conv.ID, err)
+	}
+}
+
+// listConversationsHandler returns recent conversations
+func listConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+
+	conversations, err := db.ListConversations(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("Error listing conversations: %v", err)
+		http.Error(w, "Failed to list conversations", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, conversations)
+}
+
+// getConversationHandler returns a conversation with its full message history
+func getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conv, err := db.GetConversation(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeLookupError(w, "conversation", err)
+		return
+	}
+
+	conv.Messages, err = db.GetMessages(r.Context(), conv.ID)
+	if err != nil {
+		log.Printf("Error getting messages for %s: %v", conv.ID, err)
+		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, conv)
+}
+
+// renameConversationHandler updates the title of a conversation
+func renameConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		http.Error(w, "Title is required", http.StatusBadRequest)
+		return
+	}
+
+	conv, err := db.RenameConversation(r.Context(), r.PathValue("id"), title)
+	if err != nil {
+		writeLookupError(w, "conversation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, conv)
+}
+
+// deleteConversationHandler removes a conversation and its messages
+func deleteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if err := db.DeleteConversation(r.Context(), r.PathValue("id")); err != nil {
+		writeLookupError(w, "conversation", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Crawl defaults used when a source doesn't set them
+const (
+	defaultCrawlDepth = 2
+	defaultCrawlPages = 100
+)
+
+// robotsAgent is the product token matched against robots.txt user-agent lines
+const robotsAgent = "smart-ai-assistant"
+
+// errNotHTML is returned when a crawled URL isn't an HTML page
+var errNotHTML = errors.New("not an HTML page")
+
+// CrawlOptions control which pages a crawl source follows
+type CrawlOptions struct {
+	// MaxDepth is the number of links followed from the seed URL
+	MaxDepth int `json:"max_depth,omitempty"`
+	// MaxPages bounds the number of pages ingested per crawl
+	MaxPages int `json:"max_pages,omitempty"`
+	// Domains lists the hosts in scope, including their subdomains;
+	// defaults to the host of the seed URL
+	Domains []string `json:"domains,omitempty"`
+	// PathPrefix limits the crawl to URLs below a path; defaults to the
+	// directory of the seed URL
+	PathPrefix string `json:"path_prefix,omitempty"`
+}
+
+// crawlItem is a URL waiting to be crawled
+type crawlItem struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// crawlProgress is the resumable state of a crawl. Failed holds the
+// document IDs of pages that could not be fetched this crawl; their
+// documents from earlier crawls are kept. Pages maps the URLs pages were
+// reached by to their document IDs, which are keyed by the canonical URL,
+// and is carried over from earlier crawls so a failed page is found under
+// its document.
+type crawlProgress struct {
+	Frontier  []crawlItem       `json:"frontier"`
+	Visited   []string          `json:"visited"`
+	Documents []string          `json:"documents"`
+	Failed    []string          `json:"failed,omitempty"`
+	Pages     map[string]string `json:"pages,omitempty"`
+}
+
+// Value implements the driver.Valuer interface
+func (p crawlProgress) Value() (driver.Value, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal crawl progress: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (p *crawlProgress) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("cannot scan %T into crawlProgress", src)
+	}
+}
+
+// crawlState is the persisted state of the current or last crawl of a source
+type crawlState struct {
+	SourceID    string        `db:"source_id"`
+	Progress    crawlProgress `db:"progress"`
+	StartedAt   time.Time     `db:"started_at"`
+	CompletedAt *time.Time    `db:"completed_at"`
+}
+
+// crawler holds the working state of a crawl run
+type crawler struct {
+	ingester *Ingester
+	source   Source
+	opts     CrawlOptions
+	domains  []string
+	prefix   string
+	robots   map[string]*robotsRules
+	state    *crawlState
+
+	// seen holds visited and queued URLs, documents the indexed documents
+	seen      map[string]bool
+	documents map[string]bool
+}
+
+// crawlSource crawls a website from the source URL, indexing every page in
+// scope as its own document. Progress is saved after every page so an
+// interrupted crawl resumes where it stopped; a finished crawl starts over
+// on the next run and removes the documents of pages that are gone. The run
+// fails if the robots.txt of the seed URL's origin can't be fetched.
+func (i *Ingester) crawlSource(ctx context.Context, source Source, stats *RunStats) error {
+	seed, err := url.Parse(source.URL)
+	if err != nil {
+		return permanent(fmt.Errorf("invalid crawl URL: %w", err))
+	}
+
+	c := &crawler{
+		ingester:  i,
+		source:    source,
+		opts:      source.Options.crawl(),
+		robots:    map[string]*robotsRules{},
+		seen:      map[string]bool{},
+		documents: map[string]bool{},
+	}
+	c.domains = c.opts.Domains
+	if len(c.domains) == 0 {
+		c.domains = []string{seed.Hostname()}
+	}
+	c.prefix = c.opts.PathPrefix
+	if c.prefix == "" {
+		c.prefix = seed.Path[:strings.LastIndex(seed.Path, "/")+1]
+	}
+	if c.prefix == "" {
+		c.prefix = "/"
+	}
+
+	robots := c.robotsFor(ctx, seed)
+	if robots.err != nil {
+		return robots.err
+	}
+
+	c.state, err = i.loadCrawlState(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+	if c.state == nil || c.state.CompletedAt != nil {
+		c.state = newCrawlState(source.ID, c.state)
+		c.enqueue(normalizeURL(seed), 0)
+		c.enqueueSitemaps(ctx, seed, robots)
+	} else {
+		log.Printf("Resuming crawl of %s with %d queued pages", source.URL, len(c.state.Progress.Frontier))
+		for _, visited := range c.state.Progress.Visited {
+			c.seen[visited] = true
+		}
+		for _, item := range c.state.Progress.Frontier {
+			c.seen[item.URL] = true
+		}
+		for _, docID := range c.state.Progress.Documents {
+			c.documents[docID] = true
+		}
+		if c.state.Progress.Pages == nil {
+			c.state.Progress.Pages = map[string]string{}
+		}
+	}
+
+	progress := &c.state.Progress
+	for len(progress.Frontier) > 0 && len(progress.Documents) < c.opts.MaxPages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item := progress.Frontier[0]
+		progress.Frontier = progress.Frontier[1:]
+		progress.Visited = append(progress.Visited, item.URL)
+		c.crawlPage(ctx, item, stats)
+
+		if err := i.saveCrawlState(ctx, c.state); err != nil {
+			return err
+		}
+	}
+
+	// The crawl is complete: drop documents of pages that no longer exist,
+	// keeping those of pages that failed. A crawl that indexed nothing
+	// removes nothing, and neither does one that stopped at max_pages with
+	// pages left, as those pages were not checked.
+	keep := slices.Concat(progress.Documents, progress.Failed)
+	if len(progress.Documents) > 0 && len(progress.Frontier) == 0 {
+		removed, err := db.DeleteMissingDocuments(ctx, source.ID, keep)
+		if err != nil {
+			return err
+		}
+		stats.DocumentsRemoved = removed
+
+		// Forget the URLs of removed documents
+		kept := make(map[string]bool, len(keep))
+		for _, docID := range keep {
+			kept[docID] = true
+		}
+		for pageURL, docID := range progress.Pages {
+			if !kept[docID] {
+				delete(progress.Pages, pageURL)
+			}
+		}
+	}
+
+	now := time.Now()
+	c.state.CompletedAt = &now
+	return i.saveCrawlState(ctx, c.state)
+}
+
+// crawlPage fetches and indexes one page and queues its links
+func (c *crawler) crawlPage(ctx context.Context, item crawlItem, stats *RunStats) {
+	target, err := url.Parse(item.URL)
+	if err != nil {
+		return
+	}
+	robots := c.robotsFor(ctx, target)
+	if robots.err != nil {
+		c.fail(item, robots.err, stats)
+		return
+	}
+	if !robots.allowed(target) {
+		return
+	}
+
+	var page *webPage
+	attempts, err := retry(ctx, c.ingester.fetchPolicy(), "fetch of "+item.URL, func(ctx context.Context) error {
+		ctx, cancel := withRequestTimeout(ctx, time.Duration(c.ingester.cfg.Sources.TimeoutDuration))
+		defer cancel()
+
+		var err error
+		page, err = c.ingester.webProcessor.fetchPage(ctx, item.URL, c.source.Options.extract(), nil, robots.crawlDelay)
+		return err
+	})
+	stats.Attempts += attempts
+	if errors.Is(err, errNotHTML) {
+		return
+	}
+	if err != nil {
+		c.fail(item, err, stats)
+		return
+	}
+	stats.ItemsFetched++
+
+	// Follow links before deduplicating so pages reachable only through a
+	// duplicate are still found
+	if item.Depth < c.opts.MaxDepth {
+		for _, link := range page.Links {
+			if u, err := url.Parse(link); err == nil {
+				c.enqueue(normalizeURL(u), item.Depth+1)
+			}
+		}
+	}
+
+	// Pages reached through several URLs are ingested once, under their
+	// canonical URL
+	content := page.content()
+	if content.Text == "" {
+		return
+	}
+	docID := documentID(c.source.ID, contentKey(content))
+	c.state.Progress.Pages[item.URL] = docID
+	if c.documents[docID] {
+		return
+	}
+	c.ingester.indexContent(ctx, c.source, content, stats)
+	c.documents[docID] = true
+	c.state.Progress.Documents = append(c.state.Progress.Documents, docID)
+}
+
+// fail records a page that could not be crawled and keeps its document from
+// earlier crawls, found by the URL the page was reached by
+func (c *crawler) fail(item crawlItem, err error, stats *RunStats) {
+	stats.addFailure(item.URL, err)
+	docID, ok := c.state.Progress.Pages[item.URL]
+	if !ok {
+		docID = documentID(c.source.ID, item.URL)
+	}
+	c.state.Progress.Failed = append(c.state.Progress.Failed, docID)
+}
+
+// newCrawlState starts a crawl, carrying over the page documents of the
+// previous crawl
+func newCrawlState(sourceID string, previous *crawlState) *crawlState {
+	state := &crawlState{SourceID: sourceID, StartedAt: time.Now()}
+	state.Progress.Pages = map[string]string{}
+	if previous != nil {
+		for pageURL, docID := range previous.Progress.Pages {
+			state.Progress.Pages[pageURL] = docID
+		}
+	}
+	return state
+}
+
+// enqueue queues a URL if it is in scope and hasn't been seen
+func (c *crawler) enqueue(key string, depth int) {
+	if key == "" || c.seen[key] || !c.inScope(key) {
+		return
+	}
+	c.seen[key] = true
+	c.state.Progress.Frontier = append(c.state.Progress.Frontier, crawlItem{URL: key, Depth: depth})
+}
+
+// inScope reports whether a URL is on an allowed domain below the path prefix
+func (c *crawler) inScope(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if !strings.HasPrefix(u.Path, c.prefix) {
+		return false
+	}
+
+	host := u.Hostname()
+	for _, domain := range c.domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsFor returns the robots.txt rules of a URL's host, fetching them once
+// per crawl run. If robots.txt is unavailable, the rules disallow everything
+// and carry the error.
+func (c *crawler) robotsFor(ctx context.Context, u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	if rules, ok := c.robots[origin]; ok {
+		return rules
+	}
+
+	rules, err := c.ingester.fetchRobots(ctx, origin)
+	if err != nil {
+		log.Printf("Skipping %s for this crawl, robots.txt unavailable: %v", origin, err)
+		rules = &robotsRules{disallowAll: true, err: fmt.Errorf("failed to fetch robots.txt of %s: %w", origin, err)}
+	}
+	c.robots[origin] = rules
+	return rules
+}
+
+// enqueueSitemaps queues the in-scope URLs listed in the sitemaps named by
+// robots.txt, or in /sitemap.xml when robots.txt names none
+func (c *crawler) enqueueSitemaps(ctx context.Context, seed *url.URL, robots *robotsRules) {
+	sitemaps := robots.sitemaps
+	if len(sitemaps) == 0 {
+		sitemaps = []string{seed.Scheme + "://" + seed.Host + "/sitemap.xml"}
+	}
+
+	// Sitemap indexes are followed one level deep
+	for depth := 0; depth < 2 && len(sitemaps) > 0; depth++ {
+		var nested []string
+		for _, sitemapURL := range sitemaps {
+			pages, children, err := c.ingester.fetchSitemap(ctx, sitemapURL)
+			if err != nil {
+				continue
+			}
+			for _, page := range pages {
+				if u, err := url.Parse(page); err == nil {
+					c.enqueue(normalizeURL(u), 1)
+				}
+			}
+			nested = append(nested, children...)
+		}
+		sitemaps = nested
+	}
+}
+
+// normalizeURL canonicalizes a URL for deduplication: lower-case scheme and
+// host, no default port, no fragment and a non-empty path
+func normalizeURL(u *url.URL) string {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+		n.Host = n.Hostname()
+	}
+	n.Fragment = ""
+	n.RawFragment = ""
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	return n.String()
+}
+
+// sitemapXML covers both <urlset> sitemaps and <sitemapindex> indexes
+type sitemapXML struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// fetchSitemap returns the page URLs and nested sitemap URLs of a sitemap
+func (i *Ingester) fetchSitemap(ctx context.Context, sitemapURL string) ([]string, []string, error) {
+	ctx, cancel := withRequestTimeout(ctx, time.Duration(i.cfg.Sources.TimeoutDuration))
+	defer cancel()
+
+	resp, err := getURL(ctx, i.webProcessor.client, sitemapURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var sitemap sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 50<<20)).Decode(&sitemap); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	var pages, children []string
+	for _, entry := range sitemap.URLs {
+		pages = append(pages, strings.TrimSpace(entry.Loc))
+	}
+	for _, entry := range sitemap.Sitemaps {
+		children = append(children, strings.TrimSpace(entry.Loc))
+	}
+	return pages, children, nil
+}
+
+// robotsRules are the robots.txt rules that apply to this crawler
+type robotsRules struct {
+	// err is set when robots.txt could not be fetched
+	err         error
+	disallowAll bool
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	sitemaps    []string
+}
+
+// robotsRule is an Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// fetchRobots fetches and parses the robots.txt of an origin. A missing
+// robots.txt allows everything.
+func (i *Ingester) fetchRobots(ctx context.Context, origin string) (*robotsRules, error) {
+	ctx, cancel := withRequestTimeout(ctx, time.Duration(i.cfg.Sources.TimeoutDuration))
+	defer cancel()
+
+	resp, err := getURL(ctx, i.webProcessor.client, origin+"/robots.txt", nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+		return &robotsRules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512<<10))
+	if err != nil {
+		return nil, err
+	}
+	return parseRobots(string(body), robotsAgent), nil
+}
+
+// parseRobots parses robots.txt, using the group for agent if there is one
+// and the "*" group otherwise
+func parseRobots(body, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		lines  [][2]string
+	}
+
+	var groups []*group
+	var current *group
+	rules := &robotsRules{}
+
+	for _, line := range strings.Split(body, "\n") {
+		if hash := strings.IndexByte(line, '#'); hash >= 0 {
+			line = line[:hash]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share one group
+			if current == nil || len(current.lines) > 0 {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "sitemap":
+			rules.sitemaps = append(rules.sitemaps, value)
+		default:
+			if current != nil {
+				current.lines = append(current.lines, [2]string{key, value})
+			}
+		}
+	}
+
+	var matched, wildcard *group
+	for _, g := range groups {
+		for _, name := range g.agents {
+			if name == "*" && wildcard == nil {
+				wildcard = g
+			} else if name != "*" && strings.Contains(strings.ToLower(agent), name) && matched == nil {
+				matched = g
+			}
+		}
+	}
+	if matched == nil {
+		matched = wildcard
+	}
+	if matched == nil {
+		return rules
+	}
+
+	for _, line := range matched.lines {
+		switch line[0] {
+		case "allow", "disallow":
+			if line[1] == "" {
+				continue
+			}
+			rules.rules = append(rules.rules, robotsRule{
+				allow:   line[0] == "allow",
+				length:  len(line[1]),
+				pattern: robotsPattern(line[1]),
+			})
+		case "crawl-delay":
+			var seconds float64
+			if _, err := fmt.Sscanf(line[1], "%g", &seconds); err == nil && seconds > 0 {
+				rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return rules
+}
+
+// robotsPattern compiles a robots.txt path pattern with * and $ wildcards
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed applies the most specific matching rule to a URL; Allow wins ties
+func (r *robotsRules) allowed(u *url.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
+
+// loadCrawlState returns the state of the last crawl of a source, or nil
+func (i *Ingester) loadCrawlState(ctx context.Context, sourceID string) (*crawlState, error) {
+	query := `SELECT source_id, progress, started_at, completed_at FROM crawl_state WHERE source_id = $1`
+
+	var state crawlState
+	err := i.db.GetContext(ctx, &state, query, sourceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load crawl state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveCrawlState persists the progress of a crawl
+func (i *Ingester) saveCrawlState(ctx context.Context, state *crawlState) error {
+	query := `
+		INSERT INTO crawl_state (source_id, progress, started_at, completed_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (source_id) DO UPDATE
+		SET progress = EXCLUDED.progress,
+			started_at = EXCLUDED.started_at,
+			completed_at = EXCLUDED.completed_at,
+			updated_at = CURRENT_TIMESTAMP`
+
+	if _, err := i.db.ExecContext(ctx, query, state.SourceID, state.Progress, state.StartedAt, state.CompletedAt); err != nil {
+		return fmt.Errorf("failed to save crawl state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+const robotsTxt = `# Example robots.txt
+User-agent: *
+Disallow: /private/
+Crawl-delay: 5
+
+User-agent: Googlebot
+User-agent: smart-ai-assistant
+Disallow: /
+Allow: /docs/
+Disallow: /docs/drafts/
+Allow: /docs/drafts/public$
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 1.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func mustURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", raw, err)
+	}
+	return u
+}
+
+func TestParseRobots(t *testing.T) {
+	rules := parseRobots(robotsTxt, robotsAgent)
+
+	if rules.crawlDelay != 1500*time.Millisecond {
+		t.Errorf("crawl delay = %v, want the agent group's 1.5s", rules.crawlDelay)
+	}
+	if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %v", rules.sitemaps)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", false},
+		{"/about", false},
+		{"/docs/", true},
+		{"/docs/setup", true},
+		{"/docs/drafts/next", false},
+		{"/docs/drafts/public", true},
+		{"/docs/drafts/public/more", false},
+		{"/docs/manual.pdf", false},
+		{"/docs/manual.pdf?download=1", true},
+		{"/search?q=go", false},
+		{"/private/", false},
+	}
+	for _, tt := range tests {
+		if got := rules.allowed(mustURL(t, "https://example.com"+tt.path)); got != tt.want {
+			t.Errorf("allowed(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRobotsFallsBackToWildcard(t *testing.T) {
+	rules := parseRobots(robotsTxt, "other-bot")
+
+	if rules.crawlDelay != 5*time.Second {
+		t.Errorf("crawl delay = %v, want the wildcard group's 5s", rules.crawlDelay)
+	}
+	if rules.allowed(mustURL(t, "https://example.com/private/x")) {
+		t.Error("/private/x should be disallowed by the wildcard group")
+	}
+	if !rules.allowed(mustURL(t, "https://example.com/")) {
+		t.Error("/ should be allowed by the wildcard group")
+	}
+}
+
+func TestParseRobotsEmpty(t *testing.T) {
+	for _, body := range []string{"", "User-agent: *\nDisallow:\n", "garbage\n"} {
+		if !parseRobots(body, robotsAgent).allowed(mustURL(t, "https://example.com/anything")) {
+			t.Errorf("robots.txt %q should allow everything", body)
+		}
+	}
+}
+
+func TestRobotsFor(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	newCrawler := func() *crawler {
+		ingester := &Ingester{
+			cfg:          &config.Config{},
+			webProcessor: &WebProcessor{client: server.Client()},
+		}
+		return &crawler{ingester: ingester, robots: map[string]*robotsRules{}}
+	}
+	page := mustURL(t, server.URL+"/private/page")
+
+	rules := newCrawler().robotsFor(context.Background(), page)
+	if rules.err != nil || rules.allowed(page) {
+		t.Errorf("with robots.txt: err = %v, allowed = %v; want the page disallowed", rules.err, rules.allowed(page))
+	}
+
+	status = http.StatusNotFound
+	rules = newCrawler().robotsFor(context.Background(), page)
+	if rules.err != nil || !rules.allowed(page) {
+		t.Errorf("without robots.txt: err = %v, allowed = %v; want everything allowed", rules.err, rules.allowed(page))
+	}
+
+	status = http.StatusServiceUnavailable
+	c := newCrawler()
+	rules = c.robotsFor(context.Background(), page)
+	if rules.err == nil || !isTransient(rules.err) || rules.allowed(page) {
+		t.Errorf("unavailable robots.txt: err = %v, allowed = %v; want a transient error and nothing allowed", rules.err, rules.allowed(page))
+	}
+
+	status = http.StatusOK
+	if again := c.robotsFor(context.Background(), page); again != rules {
+		t.Error("robots.txt should be fetched once per crawl")
+	}
+}
+
+func TestCrawlKeepsCanonicalDocumentOfFailedPage(t *testing.T) {
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/docs/guide":
+			http.NotFound(w, r)
+		case failing:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="canonical" href="/docs/guide"></head>
+				<body><article><h1>Guide</h1><p>How to set everything up, step by step.</p></article></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	source := Source{ID: "crawl-1", URL: server.URL + "/docs/"}
+	ingester := &Ingester{
+		cfg:          &config.Config{},
+		webProcessor: &WebProcessor{client: server.Client(), hosts: newHostLimiter(1, 0)},
+	}
+	newCrawler := func(previous *crawlState) *crawler {
+		return &crawler{
+			ingester:  ingester,
+			source:    source,
+			robots:    map[string]*robotsRules{},
+			state:     newCrawlState(source.ID, previous),
+			seen:      map[string]bool{},
+			documents: map[string]bool{},
+		}
+	}
+	reached := crawlItem{URL: server.URL + "/docs/guide?utm_source=feed", Depth: 1}
+	canonicalID := documentID(source.ID, server.URL+"/docs/guide")
+
+	// The first crawl has already indexed the canonical page, so reaching it
+	// through the tracking URL only records where it was found
+	first := newCrawler(nil)
+	first.documents[canonicalID] = true
+	var stats RunStats
+	first.crawlPage(context.Background(), reached, &stats)
+	if got := first.state.Progress.Pages[reached.URL]; got != canonicalID {
+		t.Fatalf("page of %s = %q, want the canonical document %q", reached.URL, got, canonicalID)
+	}
+
+	failing = true
+	second := newCrawler(first.state)
+	stats = RunStats{}
+	second.crawlPage(context.Background(), reached, &stats)
+
+	if stats.DocumentsFailed != 1 || stats.ItemsFetched != 0 {
+		t.Errorf("stats = %+v, want one failure and nothing fetched", stats)
+	}
+	if failed := second.state.Progress.Failed; len(failed) != 1 || failed[0] != canonicalID {
+		t.Errorf("failed = %v, want the canonical document %q kept", failed, canonicalID)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := map[string]string{
+		"HTTPS://Example.COM:443/a?b=1#frag": "https://example.com/a?b=1",
+		"http://example.com:80":              "http://example.com/",
+		"http://example.com:8080/x":          "http://example.com:8080/x",
+		"mailto:someone@example.com":         "",
+		"ftp://example.com/file":             "",
+	}
+	for raw, want := range tests {
+		if got := normalizeURL(mustURL(t, raw)); got != want {
+			t.Errorf("normalizeURL(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestCrawlerInScope(t *testing.T) {
+	c := &crawler{domains: []string{"Example.com"}, prefix: "/docs/"}
+
+	tests := map[string]bool{
+		"https://example.com/docs/a":      true,
+		"https://api.example.com/docs/a":  true,
+		"https://example.com/blog/a":      false,
+		"https://notexample.com/docs/a":   false,
+		"https://example.com.evil/docs/a": false,
+		"ftp://example.com/docs/a":        false,
+	}
+	for raw, want := range tests {
+		if got := c.inScope(raw); got != want {
+			t.Errorf("inScope(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
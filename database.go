@@ -2,7 +2,14 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -10,6 +17,122 @@ import (
 	"github.com/mohammedrefaat/smart-ai-assistant/config"
 )
 
+// JSONB holds a raw JSON value stored in a jsonb column
+type JSONB []byte
+
+// Value implements the driver.Valuer interface
+func (j JSONB) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (j *JSONB) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], v...)
+	case string:
+		*j = JSONB(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONB", src)
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (j JSONB) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// Metadata is a free-form JSON object stored in a jsonb column
+type Metadata map[string]interface{}
+
+// Value implements the driver.Valuer interface
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	return json.Unmarshal(data, m)
+}
+
+// Vector is an embedding stored in a pgvector column
+type Vector []float64
+
+// Value implements the driver.Valuer interface using pgvector's text format
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]", nil
+}
+
+// Scan implements the sql.Scanner interface
+func (v *Vector) Scan(src interface{}) error {
+	var text string
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		text = string(s)
+	case string:
+		text = s
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+
+	text = strings.Trim(text, "[]")
+	if text == "" {
+		*v = Vector{}
+		return nil
+	}
+
+	parts := strings.Split(text, ",")
+	vec := make(Vector, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		vec[i] = f
+	}
+	*v = vec
+	return nil
+}
+
 // InitPostgres creates a new database connection
 func InitPostgres(cfg *config.Config) (*DB, error) {
 	db, err := sqlx.Connect("postgres", cfg.Database.GetDatabaseURL())
@@ -31,30 +154,160 @@ func InitPostgres(cfg *config.Config) (*DB, error) {
 		return nil, fmt.Errorf("failed to initialize extensions: %w", err)
 	}
 
-	if err := initializeSchema(db); err != nil {
+	if err := initializeSchema(db, cfg.AI.EmbeddingDim); err != nil {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if err := ensureEmbeddingDimension(db, cfg.AI.EmbeddingDim); err != nil {
+		return nil, fmt.Errorf("failed to verify embedding column: %w", err)
+	}
+
 	return &DB{Sdb: db, cfg: cfg}, nil
 }
 
 // initializeSchema creates the necessary tables if they don't exist
-func initializeSchema(db *sqlx.DB) error {
-	schema := `
+func initializeSchema(db *sqlx.DB, embeddingDim int) error {
+	schema := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS knowledge_sources (
+			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			url TEXT NOT NULL,
+			schedule TEXT NOT NULL,
+			last_updated TIMESTAMP WITH TIME ZONE,
+			active BOOLEAN DEFAULT true,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		ALTER TABLE knowledge_sources ADD COLUMN IF NOT EXISTS options JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE knowledge_sources ADD COLUMN IF NOT EXISTS consecutive_failures INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE knowledge_sources ADD COLUMN IF NOT EXISTS dead_lettered_at TIMESTAMP WITH TIME ZONE;
+		ALTER TABLE knowledge_sources ADD COLUMN IF NOT EXISTS dead_letter_reason TEXT NOT NULL DEFAULT '';
+
+		CREATE INDEX IF NOT EXISTS idx_knowledge_sources_active ON knowledge_sources(active);
+
 		CREATE TABLE IF NOT EXISTS knowledge_base (
 			id SERIAL PRIMARY KEY,
 			doc_id VARCHAR(255) UNIQUE NOT NULL,
 			content TEXT NOT NULL,
-			embedding vector(1536),
+			embedding vector(%d),
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		);
 
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS parent_doc_id VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS chunk_index INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS start_offset INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS end_offset INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS url TEXT NOT NULL DEFAULT '';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS source_type VARCHAR(32) NOT NULL DEFAULT '';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS source_id TEXT REFERENCES knowledge_sources(id) ON DELETE CASCADE;
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS published_at TIMESTAMP WITH TIME ZONE;
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
 		CREATE INDEX IF NOT EXISTS idx_knowledge_base_doc_id ON knowledge_base(doc_id);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_parent_doc_id ON knowledge_base(parent_doc_id);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_source_id ON knowledge_base(source_id);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_source_type ON knowledge_base(source_type);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_published_at ON knowledge_base(published_at);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_tags ON knowledge_base USING GIN (tags);
+
+		ALTER TABLE knowledge_base ADD COLUMN IF NOT EXISTS content_tsv tsvector
+			GENERATED ALWAYS AS (to_tsvector('english', title || ' ' || content)) STORED;
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_content_tsv ON knowledge_base USING GIN (content_tsv);
 		CREATE INDEX IF NOT EXISTS idx_knowledge_base_created_at ON knowledge_base(created_at);
 		CREATE INDEX IF NOT EXISTS idx_knowledge_base_embedding ON knowledge_base USING ivfflat (embedding vector_cosine_ops)
 			WITH (lists = 100);
-	`
+
+		CREATE TABLE IF NOT EXISTS ingestion_runs (
+			id SERIAL PRIMARY KEY,
+			source_id TEXT NOT NULL REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			status VARCHAR(16) NOT NULL,
+			trigger VARCHAR(16) NOT NULL,
+			queued_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP WITH TIME ZONE,
+			finished_at TIMESTAMP WITH TIME ZONE,
+			duration_ms BIGINT,
+			items_fetched INTEGER NOT NULL DEFAULT 0,
+			documents_added INTEGER NOT NULL DEFAULT 0,
+			documents_failed INTEGER NOT NULL DEFAULT 0,
+			chunks_added INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			failures JSONB NOT NULL DEFAULT '[]'
+		);
+
+		ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS documents_updated INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS documents_unchanged INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS documents_removed INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE ingestion_runs ADD COLUMN IF NOT EXISTS not_modified BOOLEAN NOT NULL DEFAULT false;
+
+		CREATE INDEX IF NOT EXISTS idx_ingestion_runs_source_id ON ingestion_runs(source_id, queued_at);
+		CREATE INDEX IF NOT EXISTS idx_ingestion_runs_status ON ingestion_runs(status);
+
+		CREATE TABLE IF NOT EXISTS http_cache (
+			source_id TEXT NOT NULL REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			etag TEXT NOT NULL DEFAULT '',
+			last_modified TEXT NOT NULL DEFAULT '',
+			checked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			changed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (source_id, url)
+		);
+
+		CREATE TABLE IF NOT EXISTS crawl_state (
+			source_id TEXT PRIMARY KEY REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			progress JSONB NOT NULL,
+			started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			completed_at TIMESTAMP WITH TIME ZONE,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS feed_items (
+			source_id TEXT NOT NULL REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			guid TEXT NOT NULL,
+			seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (source_id, guid)
+		);
+
+		CREATE TABLE IF NOT EXISTS directory_files (
+			source_id TEXT NOT NULL REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			doc_id TEXT NOT NULL,
+			mod_time TIMESTAMP WITH TIME ZONE NOT NULL,
+			size BIGINT NOT NULL,
+			PRIMARY KEY (source_id, path)
+		);
+
+		CREATE TABLE IF NOT EXISTS git_state (
+			source_id TEXT PRIMARY KEY REFERENCES knowledge_sources(id) ON DELETE CASCADE,
+			commit_sha TEXT NOT NULL,
+			ref TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS conversations (
+			id VARCHAR(255) PRIMARY KEY,
+			title TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS conversation_messages (
+			id SERIAL PRIMARY KEY,
+			conversation_id VARCHAR(255) NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			role VARCHAR(16) NOT NULL,
+			content TEXT NOT NULL,
+			sources JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
+		CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation_id ON conversation_messages(conversation_id, created_at);
+	`, embeddingDim)
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
@@ -63,6 +316,43 @@ func initializeSchema(db *sqlx.DB) error {
 	return nil
 }
 
+// ensureEmbeddingDimension checks that the knowledge_base embedding column
+// matches the configured dimension. An empty table is migrated to the new
+// dimension; a populated one would need re-embedding, so it is an error.
+func ensureEmbeddingDimension(db *sqlx.DB, embeddingDim int) error {
+	// pgvector stores the declared dimension as the column's type modifier
+	var columnDim int
+	query := `
+		SELECT atttypmod
+		FROM pg_attribute
+		WHERE attrelid = 'knowledge_base'::regclass AND attname = 'embedding'`
+
+	if err := db.Get(&columnDim, query); err != nil {
+		return fmt.Errorf("failed to read embedding column dimension: %w", err)
+	}
+
+	if columnDim == embeddingDim {
+		return nil
+	}
+
+	var count int64
+	if err := db.Get(&count, "SELECT COUNT(*) FROM knowledge_base"); err != nil {
+		return fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("embedding column has dimension %d but embeddingDim is %d and %d documents would need re-embedding",
+			columnDim, embeddingDim, count)
+	}
+
+	alter := fmt.Sprintf(`ALTER TABLE knowledge_base ALTER COLUMN embedding TYPE vector(%d)`, embeddingDim)
+	if _, err := db.Exec(alter); err != nil {
+		return fmt.Errorf("failed to migrate embedding column: %w", err)
+	}
+
+	return nil
+}
+
 // initializeExtensions ensures required PostgreSQL extensions are installed
 func initializeExtensions(db *sqlx.DB) error {
 	// Create the vector extension if it doesn't exist
@@ -90,7 +380,7 @@ func (db *DB) AddDocument(ctx context.Context, docID string, content string, emb
 	err := db.Sdb.QueryRowxContext(ctx, query,
 		docID,
 		content,
-		pq.Array(embedding),
+		Vector(embedding),
 	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
 
 	if err != nil {
@@ -100,29 +390,253 @@ func (db *DB) AddDocument(ctx context.Context, docID string, content string, emb
 	return nil
 }
 
+// DocumentChunk is a chunk of a parent document together with its embedding
+type DocumentChunk struct {
+	Chunk
+	Embedding []float64
+}
+
+// chunkDocID returns the doc_id of a chunk of the given parent document
+func chunkDocID(parentDocID string, index int) string {
+	return fmt.Sprintf("%s#%d", parentDocID, index)
+}
+
+// ReplaceDocumentChunks stores the chunks of a document as separate rows,
+// replacing any chunks previously stored for the same parent document.
+// Every chunk carries the metadata of the content it was cut from, and the
+// label and URL of the location its text starts at.
+func (db *DB) ReplaceDocumentChunks(ctx context.Context, parentDocID, contentHash string, content Content, chunks []DocumentChunk) error {
+	tx, err := db.Sdb.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Keep the creation time of the document across updates
+	var createdAt sql.NullTime
+	err = tx.GetContext(ctx, &createdAt, `SELECT MIN(created_at) FROM knowledge_base WHERE parent_doc_id = $1`, parentDocID)
+	if err != nil {
+		return fmt.Errorf("failed to get previous chunks: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM knowledge_base WHERE parent_doc_id = $1`, parentDocID); err != nil {
+		return fmt.Errorf("failed to delete previous chunks: %w", err)
+	}
+
+	query := `
+		INSERT INTO knowledge_base (doc_id, parent_doc_id, chunk_index, start_offset, end_offset,
+			content, embedding, title, url, source, source_type, source_id, published_at, tags, metadata,
+			content_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			COALESCE($17, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP)`
+
+	for _, chunk := range chunks {
+		location := locationAt(content.Locations, chunk.Start)
+		url := content.URL
+		if location.URL != "" {
+			url = location.URL
+		}
+
+		_, err := tx.ExecContext(ctx, query,
+			chunkDocID(parentDocID, chunk.Index),
+			parentDocID,
+			chunk.Index,
+			chunk.Start,
+			chunk.End,
+			chunk.Text,
+			Vector(chunk.Embedding),
+			content.Title,
+			url,
+			content.Source,
+			content.SourceType,
+			nullString(content.SourceID),
+			nullTime(content.PublishedAt),
+			pq.StringArray(content.Tags),
+			chunkMetadata(content.Metadata, chunk.Chunk, location),
+			contentHash,
+			createdAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert chunk %d: %w", chunk.Index, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DocumentHash returns the content hash stored for a document and whether
+// the document exists
+func (db *DB) DocumentHash(ctx context.Context, parentDocID string) (string, bool, error) {
+	var hash string
+	query := `SELECT content_hash FROM knowledge_base WHERE parent_doc_id = $1 LIMIT 1`
+	err := db.Sdb.GetContext(ctx, &hash, query, parentDocID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get document hash: %w", err)
+	}
+	return hash, true, nil
+}
+
+// DeleteMissingDocuments removes the documents of a source that are not in
+// keep and returns how many documents were removed. An empty keep list
+// removes nothing, so a fetch that came back empty, such as an API returning
+// [] or an unmounted directory, cannot wipe out a source.
+func (db *DB) DeleteMissingDocuments(ctx context.Context, sourceID string, keep []string) (int, error) {
+	if len(keep) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		WITH deleted AS (
+			DELETE FROM knowledge_base
+			WHERE source_id = $1 AND NOT (parent_doc_id = ANY($2))
+			RETURNING parent_doc_id
+		)
+		SELECT COUNT(DISTINCT parent_doc_id) FROM deleted`
+
+	var removed int
+	if err := db.Sdb.GetContext(ctx, &removed, query, sourceID, pq.StringArray(keep)); err != nil {
+		return 0, fmt.Errorf("failed to delete missing documents: %w", err)
+	}
+	return removed, nil
+}
+
+// chunkMetadata merges chunk-specific details into the document metadata
+func chunkMetadata(metadata Metadata, chunk Chunk, location Location) Metadata {
+	merged := Metadata{}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	if chunk.Heading != "" {
+		merged["heading"] = chunk.Heading
+	}
+	if location.Label != "" {
+		merged["location"] = location.Label
+	}
+	return merged
+}
+
+// locationAt returns the last location starting at or before offset
+func locationAt(locations []Location, offset int) Location {
+	i := sort.Search(len(locations), func(i int) bool { return locations[i].Offset > offset })
+	if i == 0 {
+		return Location{}
+	}
+	return locations[i-1]
+}
+
+// nullString maps an empty string to NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullTime maps the zero time to NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// documentColumns lists the knowledge_base columns scanned into a Document
+const documentColumns = `id, doc_id, parent_doc_id, chunk_index, start_offset, end_offset,
+		content, embedding, title, url, source, source_type, source_id, published_at, tags, metadata,
+		created_at, updated_at`
+
+// DocumentFilter restricts which documents are considered during retrieval.
+// Empty fields don't filter; a document must carry all of the given tags.
+type DocumentFilter struct {
+	SourceTypes     []string   `json:"source_types,omitempty"`
+	SourceIDs       []string   `json:"source_ids,omitempty"`
+	PublishedAfter  *time.Time `json:"published_after,omitempty"`
+	PublishedBefore *time.Time `json:"published_before,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+}
+
+// conditions returns SQL conditions for the filter, numbering placeholders
+// after the existing args and returning the extended argument list
+func (f *DocumentFilter) conditions(args []interface{}) (string, []interface{}) {
+	if f == nil {
+		return "", args
+	}
+
+	var where strings.Builder
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		fmt.Fprintf(&where, " AND "+condition, len(args))
+	}
+
+	if len(f.SourceTypes) > 0 {
+		add("source_type = ANY($%d)", pq.StringArray(f.SourceTypes))
+	}
+	if len(f.SourceIDs) > 0 {
+		add("source_id = ANY($%d)", pq.StringArray(f.SourceIDs))
+	}
+	if f.PublishedAfter != nil {
+		add("published_at >= $%d", *f.PublishedAfter)
+	}
+	if f.PublishedBefore != nil {
+		add("published_at < $%d", *f.PublishedBefore)
+	}
+	if len(f.Tags) > 0 {
+		add("tags @> $%d", pq.StringArray(f.Tags))
+	}
+
+	return where.String(), args
+}
+
 // QuerySimilarDocuments finds similar documents using vector similarity
-func (db *DB) querySimilarDocuments(ctx context.Context, embedding []float64, topK int, similarityThreshold float64) ([]Document, error) {
+func (db *DB) querySimilarDocuments(ctx context.Context, embedding []float64, topK int, similarityThreshold float64, filter *DocumentFilter) ([]Document, error) {
+	args := []interface{}{Vector(embedding), topK, similarityThreshold}
+	conditions, args := filter.conditions(args)
+
 	query := `
-		SELECT id, doc_id, content, embedding::float[], created_at, updated_at
+		SELECT ` + documentColumns + `, 1 - (embedding <=> $1) AS similarity
 		FROM knowledge_base
-		WHERE 1 - (embedding <=> $1) >= $3
+		WHERE 1 - (embedding <=> $1) >= $3` + conditions + `
 		ORDER BY embedding <=> $1
 		LIMIT $2`
 
 	var documents []Document
-	err := db.Sdb.SelectContext(ctx, &documents, query,
-		pq.Array(embedding),
-		topK,
-		similarityThreshold,
-	)
+	err := db.Sdb.SelectContext(ctx, &documents, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query similar documents: %w", err)
 	}
 
 	return documents, nil
 }
-func QuerySimilarDocuments(ctx context.Context, embedding []float64, topK int, similarityThreshold float64, db *DB) ([]Document, error) {
-	return db.querySimilarDocuments(ctx, embedding, topK, similarityThreshold)
+func QuerySimilarDocuments(ctx context.Context, embedding []float64, topK int, similarityThreshold float64, filter *DocumentFilter, db *DB) ([]Document, error) {
+	return db.querySimilarDocuments(ctx, embedding, topK, similarityThreshold, filter)
+}
+
+// queryKeywordDocuments finds documents matching the query text using
+// full-text search, ranked by cover density
+func (db *DB) queryKeywordDocuments(ctx context.Context, text string, topK int, filter *DocumentFilter) ([]Document, error) {
+	args := []interface{}{text, topK}
+	conditions, args := filter.conditions(args)
+
+	query := `
+		SELECT ` + documentColumns + `, ts_rank_cd(content_tsv, query) AS keyword_rank
+		FROM knowledge_base, websearch_to_tsquery('english', $1) query
+		WHERE content_tsv @@ query` + conditions + `
+		ORDER BY keyword_rank DESC
+		LIMIT $2`
+
+	var documents []Document
+	err := db.Sdb.SelectContext(ctx, &documents, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keyword documents: %w", err)
+	}
+
+	return documents, nil
+}
+func QueryKeywordDocuments(ctx context.Context, text string, topK int, filter *DocumentFilter, db *DB) ([]Document, error) {
+	return db.queryKeywordDocuments(ctx, text, topK, filter)
 }
 
 // DeleteOldDocuments removes documents older than the specified retention period
@@ -154,7 +668,7 @@ func (db *DB) Close() error {
 func (db *DB) GetDocumentByID(ctx context.Context, docID string) (*Document, error) {
 	var doc Document
 	query := `
-		SELECT id, doc_id, content, embedding::float[], created_at, updated_at
+		SELECT ` + documentColumns + `
 		FROM knowledge_base
 		WHERE doc_id = $1`
 
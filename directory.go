@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DirectoryOptions select the files of a directory source. Patterns are
+// matched against paths relative to the directory, with "**" matching any
+// number of directories, e.g. "docs/**/*.md".
+type DirectoryOptions struct {
+	// Include defaults to every file of a supported document format
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// fileState is the modification time and size a file had when it was last
+// indexed
+type fileState struct {
+	Path    string    `db:"path"`
+	ModTime time.Time `db:"mod_time"`
+	Size    int64     `db:"size"`
+}
+
+// scanDirectory indexes the files of a directory source that are new or
+// changed since the last scan, judged by modification time and size, and
+// removes the documents of deleted files. Hidden directories are skipped.
+func (i *Ingester) scanDirectory(ctx context.Context, source Source, stats *RunStats) error {
+	root := filepath.Clean(source.URL)
+	opts := source.Options.directory()
+
+	previous, err := i.loadFileStates(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	var indexed []fileState
+	partial := false
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The root must be readable; unreadable subdirectories are
+			// skipped, and their files are unknown rather than deleted
+			if file == root {
+				return permanent(err)
+			}
+			stats.addFailure(file, err)
+			partial = true
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if file != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !opts.matches(rel) {
+			return nil
+		}
+
+		stats.ItemsFetched++
+		docID := documentID(source.ID, rel)
+		keep = append(keep, docID)
+
+		info, err := entry.Info()
+		if err != nil {
+			stats.addFailure(rel, err)
+			return nil
+		}
+
+		state := fileState{Path: rel, ModTime: info.ModTime().UTC(), Size: info.Size()}
+		if last, ok := previous[rel]; ok && last.ModTime.Equal(state.ModTime) && last.Size == state.Size {
+			stats.addOutcome(IndexUnchanged, 0)
+			return nil
+		}
+
+		content, err := readDirectoryFile(file, rel, info)
+		if err != nil {
+			stats.addFailure(rel, err)
+			return nil
+		}
+		failed := stats.DocumentsFailed
+		i.indexContent(ctx, source, content, stats)
+		if stats.DocumentsFailed == failed {
+			indexed = append(indexed, state)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	if err := i.saveFileStates(ctx, source.ID, indexed); err != nil {
+		return err
+	}
+	if stats.indexed() == 0 && stats.DocumentsFailed > 0 {
+		return nil
+	}
+
+	// A directory that turned up empty is more likely unmounted than
+	// emptied, so nothing is removed
+	if partial || len(keep) == 0 {
+		return nil
+	}
+	removed, err := db.DeleteMissingDocuments(ctx, source.ID, keep)
+	if err != nil {
+		return err
+	}
+	stats.DocumentsRemoved = removed
+
+	return i.deleteMissingFileStates(ctx, source.ID, keep)
+}
+
+// readDirectoryFile extracts the content of a file, identified by its path
+// relative to the directory
+func readDirectoryFile(file, rel string, info fs.FileInfo) (Content, error) {
+	if info.Size() > maxDocumentSize {
+		return Content{}, permanent(fmt.Errorf("file is larger than %d bytes", maxDocumentSize))
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Content{}, err
+	}
+
+	content, err := extractDocument(file, "", data)
+	if err != nil {
+		return Content{}, err
+	}
+	content.ID = rel
+	content.URL = ""
+	content.Source = file
+	content.PublishedAt = info.ModTime()
+	if content.Metadata == nil {
+		content.Metadata = Metadata{}
+	}
+	content.Metadata["path"] = rel
+	return content, nil
+}
+
+// matches reports whether a relative path is included and not excluded
+func (o DirectoryOptions) matches(rel string) bool {
+	for _, pattern := range o.Exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return slices.Contains(documentFormats, strings.ToLower(path.Ext(rel)))
+	}
+	for _, pattern := range o.Include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a pattern in which "**"
+// matches zero or more directories and other segments use path.Match. A
+// pattern without a slash matches the file name in any directory.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				if matchSegments(pattern[1:], name[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// validateGlob checks that a pattern is well formed
+func validateGlob(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// loadFileStates returns the files indexed for a directory source by path
+func (i *Ingester) loadFileStates(ctx context.Context, sourceID string) (map[string]fileState, error) {
+	var states []fileState
+	query := `SELECT path, mod_time, size FROM directory_files WHERE source_id = $1`
+	if err := i.db.SelectContext(ctx, &states, query, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to load file states: %w", err)
+	}
+
+	byPath := make(map[string]fileState, len(states))
+	for _, state := range states {
+		byPath[state.Path] = state
+	}
+	return byPath, nil
+}
+
+// saveFileStates records the files indexed by a scan
+func (i *Ingester) saveFileStates(ctx context.Context, sourceID string, states []fileState) error {
+	query := `
+		INSERT INTO directory_files (source_id, path, doc_id, mod_time, size)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (source_id, path) DO UPDATE
+		SET mod_time = EXCLUDED.mod_time, size = EXCLUDED.size`
+
+	for _, state := range states {
+		_, err := i.db.ExecContext(ctx, query, sourceID, state.Path, documentID(sourceID, state.Path), state.ModTime, state.Size)
+		if err != nil {
+			return fmt.Errorf("failed to save file state: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteMissingFileStates forgets files whose documents are not in keep
+func (i *Ingester) deleteMissingFileStates(ctx context.Context, sourceID string, keep []string) error {
+	query := `DELETE FROM directory_files WHERE source_id = $1 AND NOT (doc_id = ANY($2))`
+	if _, err := i.db.ExecContext(ctx, query, sourceID, pq.StringArray(keep)); err != nil {
+		return fmt.Errorf("failed to delete file states: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/setup.md", true},
+		{"*.md", "docs/notes.txt", false},
+		{"docs/*.md", "docs/setup.md", true},
+		{"docs/*.md", "docs/guide/setup.md", false},
+		{"docs/**/*.md", "docs/setup.md", true},
+		{"docs/**/*.md", "docs/guide/deep/setup.md", true},
+		{"docs/**/*.md", "other/docs/setup.md", false},
+		{"**/drafts/**", "drafts/a.md", true},
+		{"**/drafts/**", "docs/drafts/2024/a.md", true},
+		{"**/drafts/**", "docs/draftsman/a.md", false},
+		{"docs/**", "docs", true},
+		{"docs/?.md", "docs/a.md", true},
+		{"docs/[ab].md", "docs/c.md", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDirectoryOptionsMatches(t *testing.T) {
+	defaults := DirectoryOptions{}
+	for name, want := range map[string]bool{"docs/a.md": true, "b.PDF": true, "c.docx": true, "image.png": false, "Makefile": false} {
+		if got := defaults.matches(name); got != want {
+			t.Errorf("default matches(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	opts := DirectoryOptions{Include: []string{"docs/**/*.md", "*.pdf"}, Exclude: []string{"**/drafts/**"}}
+	for name, want := range map[string]bool{
+		"docs/a.md":         true,
+		"docs/guide/b.md":   true,
+		"docs/drafts/c.md":  false,
+		"manuals/d.pdf":     true,
+		"drafts/e.pdf":      false,
+		"notes.md":          false,
+		"docs/guide/f.docx": false,
+	} {
+		if got := opts.matches(name); got != want {
+			t.Errorf("matches(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	for _, pattern := range []string{"*.md", "docs/**/*.md", "[a-z]*.txt"} {
+		if err := validateGlob(pattern); err != nil {
+			t.Errorf("validateGlob(%q): %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"", "  ", "docs/[a-.md"} {
+		if err := validateGlob(pattern); err == nil {
+			t.Errorf("validateGlob(%q) should fail", pattern)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxDocumentSize bounds the size of downloaded text documents
+const maxDocumentSize = 20 << 20
+
+// maxDOCXPart bounds the decompressed size of a DOCX document part
+const maxDOCXPart = 100 << 20
+
+var (
+	// errNoText is returned for documents that contain no text
+	errNoText = errors.New("document has no text")
+	// errUnsupportedDocument is returned for files of types that cannot be
+	// ingested
+	errUnsupportedDocument = errors.New("unsupported document type")
+)
+
+// documentFormats are the file extensions extractDocument reads
+var documentFormats = []string{".pdf", ".html", ".htm", ".docx", ".csv", ".md", ".markdown", ".txt", ".text"}
+
+// extractDocument turns a PDF, text, Markdown, HTML, DOCX or CSV file into
+// content by its extension, falling back to its media type
+func extractDocument(name, mediaType string, data []byte) (Content, error) {
+	format := strings.ToLower(path.Ext(strings.SplitN(name, "?", 2)[0]))
+	if !slices.Contains(documentFormats, format) {
+		mediaType, _, _ := mime.ParseMediaType(mediaType)
+		switch mediaType {
+		case "application/pdf":
+			format = ".pdf"
+		case "text/html", "application/xhtml+xml":
+			format = ".html"
+		case "text/csv":
+			format = ".csv"
+		case "text/plain", "text/markdown":
+			format = ".txt"
+		}
+	}
+
+	var content Content
+	var err error
+	switch format {
+	case ".pdf":
+		content, err = pdfData(data, name)
+		content.SourceType = SourceTypePDF
+	case ".html", ".htm":
+		content, err = htmlContent(name, data)
+	case ".docx":
+		content, err = docxContent(name, data)
+	case ".csv":
+		content, err = csvContent(name, data)
+	case ".md", ".markdown", ".txt", ".text":
+		content, err = textContent(name, data)
+	default:
+		return Content{}, permanent(fmt.Errorf("%w: %s, expected PDF, Markdown, text, HTML, DOCX or CSV", errUnsupportedDocument, name))
+	}
+	if err != nil {
+		return Content{}, err
+	}
+	if content.SourceType == "" {
+		content.SourceType = SourceTypeText
+	}
+	return content, nil
+}
+
+// textContent reads a plain text or Markdown document, titled by its first
+// heading or else its file name
+func textContent(name string, data []byte) (Content, error) {
+	if !utf8.Valid(data) {
+		return Content{}, permanent(fmt.Errorf("%s is not UTF-8 text", name))
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if text == "" {
+		return Content{}, permanent(errNoText)
+	}
+
+	title := fileTitle(name)
+	for _, line := range strings.SplitN(text, "\n", 20) {
+		line = strings.TrimSpace(line)
+		if isMarkdownHeading(line) {
+			title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			break
+		}
+	}
+
+	return Content{
+		Title:       title,
+		Text:        text,
+		Source:      name,
+		URL:         name,
+		PublishedAt: time.Now(),
+		Metadata:    Metadata{},
+	}, nil
+}
+
+// htmlContent extracts the main content of an HTML document as Markdown
+func htmlContent(name string, data []byte) (Content, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return Content{}, permanent(fmt.Errorf("failed to parse HTML: %w", err))
+	}
+
+	article := extractArticle(doc, ExtractOptions{})
+	if article.Text == "" {
+		return Content{}, permanent(errNoText)
+	}
+	if article.Title == "" {
+		article.Title = fileTitle(name)
+	}
+
+	return Content{
+		Title:       article.Title,
+		Text:        article.Text,
+		Source:      name,
+		URL:         name,
+		PublishedAt: time.Now(),
+		Metadata:    Metadata{},
+	}, nil
+}
+
+// csvContent renders every record of a CSV file as "column: value" lines,
+// one paragraph per record, so chunks keep rows whole
+func csvContent(name string, data []byte) (Content, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Content{}, permanent(fmt.Errorf("failed to parse CSV: %w", err))
+	}
+	if len(records) < 2 {
+		return Content{}, permanent(errNoText)
+	}
+
+	header := records[0]
+	var rows []string
+	for _, record := range records[1:] {
+		var lines []string
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			column := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && strings.TrimSpace(header[i]) != "" {
+				column = strings.TrimSpace(header[i])
+			}
+			lines = append(lines, column+": "+value)
+		}
+		if len(lines) > 0 {
+			rows = append(rows, strings.Join(lines, "\n"))
+		}
+	}
+	if len(rows) == 0 {
+		return Content{}, permanent(errNoText)
+	}
+
+	return Content{
+		Title:       fileTitle(name),
+		Text:        strings.Join(rows, "\n\n"),
+		Source:      name,
+		URL:         name,
+		PublishedAt: time.Now(),
+		Metadata:    Metadata{"columns": header, "rows": len(rows)},
+	}, nil
+}
+
+// docxContent reads the paragraphs of a Word document as Markdown, turning
+// heading styles into headings, and takes title and author from its
+// core properties
+func docxContent(name string, data []byte) (Content, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Content{}, permanent(fmt.Errorf("failed to open DOCX: %w", err))
+	}
+
+	content := Content{
+		Title:       fileTitle(name),
+		Source:      name,
+		URL:         name,
+		PublishedAt: time.Now(),
+		Metadata:    Metadata{},
+	}
+
+	body, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return Content{}, permanent(fmt.Errorf("failed to read DOCX: %w", err))
+	}
+	paragraphs, err := docxParagraphs(body)
+	if err != nil {
+		return Content{}, permanent(fmt.Errorf("failed to parse DOCX: %w", err))
+	}
+	content.Text = strings.Join(paragraphs, "\n\n")
+	if content.Text == "" {
+		return Content{}, permanent(errNoText)
+	}
+
+	if core, err := readZipFile(archive, "docProps/core.xml"); err == nil {
+		var props struct {
+			Title   string `xml:"title"`
+			Creator string `xml:"creator"`
+			Created string `xml:"created"`
+		}
+		if xml.Unmarshal(core, &props) == nil {
+			if title := strings.TrimSpace(props.Title); title != "" {
+				content.Title = title
+			}
+			if author := strings.TrimSpace(props.Creator); author != "" {
+				content.Metadata["author"] = author
+			}
+			if created, err := time.Parse(time.RFC3339, strings.TrimSpace(props.Created)); err == nil {
+				content.PublishedAt = created
+			}
+		}
+	}
+
+	return content, nil
+}
+
+// readZipFile reads a file of a zip archive
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxDOCXPart+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDOCXPart {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxDOCXPart)
+	}
+	return data, nil
+}
+
+// docxParagraphs walks the WordprocessingML body, collecting the text runs
+// of each paragraph. Paragraphs styled "Heading N" or "Title" become
+// Markdown headings and list paragraphs become list items.
+func docxParagraphs(document []byte) ([]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+
+	var paragraphs []string
+	var text strings.Builder
+	style := ""
+	listItem := false
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				text.Reset()
+				style = ""
+				listItem = false
+			case "pStyle":
+				style = xmlAttr(t, "val")
+			case "numPr":
+				listItem = true
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if paragraph := docxParagraph(strings.TrimSpace(text.String()), style, listItem); paragraph != "" {
+					paragraphs = append(paragraphs, paragraph)
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return paragraphs, nil
+}
+
+// docxParagraph formats a paragraph by its style
+func docxParagraph(text, style string, listItem bool) string {
+	if text == "" {
+		return ""
+	}
+	lower := strings.ToLower(style)
+	switch {
+	case lower == "title":
+		return "# " + text
+	case strings.HasPrefix(lower, "heading"):
+		level := 1
+		if n := strings.TrimPrefix(lower, "heading"); len(n) == 1 && n[0] >= '1' && n[0] <= '6' {
+			level = int(n[0] - '0')
+		}
+		return strings.Repeat("#", level) + " " + text
+	case listItem || strings.HasPrefix(lower, "list"):
+		return "- " + text
+	default:
+		return text
+	}
+}
+
+// xmlAttr returns the value of an attribute by its local name
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// fileTitle names a document after its file, without the extension
+func fileTitle(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if title := strings.TrimSuffix(base, path.Ext(base)); title != "" {
+		return title
+	}
+	return name
+}
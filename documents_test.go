@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const docxBody = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:body>
+    <w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Returns policy</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Time</w:t></w:r><w:r><w:t xml:space="preserve"> limits</w:t></w:r></w:p>
+    <w:p><w:r><w:t>Items can be returned</w:t></w:r><w:r><w:br/><w:t>within 30 days.</w:t></w:r></w:p>
+    <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>Keep the receipt</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="ListParagraph"/></w:pPr><w:r><w:t>Use</w:t><w:tab/><w:t>the original box</w:t></w:r></w:p>
+    <w:p><w:r><w:t>   </w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Normal"/></w:pPr><w:r><w:t>Questions? Ask support.</w:t></w:r></w:p>
+  </w:body>
+</w:document>`
+
+const docxCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+  xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">
+  <dc:title>Returns</dc:title>
+  <dc:creator>Support team</dc:creator>
+  <dcterms:created>2024-03-01T12:00:00Z</dcterms:created>
+</cp:coreProperties>`
+
+// buildDOCX zips the given parts into a document
+func buildDOCX(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, data := range parts {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+		f.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to write DOCX: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDocxParagraphs(t *testing.T) {
+	paragraphs, err := docxParagraphs([]byte(docxBody))
+	if err != nil {
+		t.Fatalf("docxParagraphs failed: %v", err)
+	}
+
+	want := []string{
+		"# Returns policy",
+		"## Time limits",
+		"Items can be returned\nwithin 30 days.",
+		"- Keep the receipt",
+		"- Use\tthe original box",
+		"Questions? Ask support.",
+	}
+	if !reflect.DeepEqual(paragraphs, want) {
+		t.Errorf("paragraphs = %q, want %q", paragraphs, want)
+	}
+
+	if _, err := docxParagraphs([]byte("<w:document><w:body>")); err == nil {
+		t.Error("docxParagraphs should fail on truncated XML")
+	}
+}
+
+func TestDocxContent(t *testing.T) {
+	data := buildDOCX(t, map[string]string{"word/document.xml": docxBody, "docProps/core.xml": docxCore})
+
+	content, err := extractDocument("uploads/returns.docx", "", data)
+	if err != nil {
+		t.Fatalf("extractDocument failed: %v", err)
+	}
+	if content.Title != "Returns" || content.Metadata["author"] != "Support team" || content.SourceType != SourceTypeText {
+		t.Errorf("title = %q, metadata = %v, type = %q", content.Title, content.Metadata, content.SourceType)
+	}
+	if !content.PublishedAt.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("published at = %v, want the created date", content.PublishedAt)
+	}
+	if !strings.HasPrefix(content.Text, "# Returns policy\n\n## Time limits\n\n") {
+		t.Errorf("text = %q", content.Text)
+	}
+
+	// Without core properties the document is named after its file
+	content, err = extractDocument("uploads/returns.docx", "", buildDOCX(t, map[string]string{"word/document.xml": docxBody}))
+	if err != nil || content.Title != "returns" {
+		t.Errorf("title = %q, err = %v; want the file name", content.Title, err)
+	}
+
+	empty := buildDOCX(t, map[string]string{"word/document.xml": `<w:document><w:body><w:p/></w:body></w:document>`})
+	if _, err := extractDocument("empty.docx", "", empty); !errors.Is(err, errNoText) {
+		t.Errorf("err = %v, want errNoText", err)
+	}
+}
+
+func TestExtractDocumentFormats(t *testing.T) {
+	content, err := extractDocument("prices.csv", "", []byte("item,price,\nbook,12,\n,,\npen,,x\n"))
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if content.Text != "item: book\nprice: 12\n\nitem: pen\ncolumn 3: x" || content.Metadata["rows"] != 2 {
+		t.Errorf("csv text = %q, metadata = %v", content.Text, content.Metadata)
+	}
+
+	// Without a known extension the media type decides
+	content, err = extractDocument("https://example.com/notes", "text/markdown; charset=utf-8", []byte("intro\n\n# Notes\n\nbody"))
+	if err != nil || content.Title != "Notes" {
+		t.Errorf("markdown title = %q, err = %v; want the first heading", content.Title, err)
+	}
+
+	if _, err := extractDocument("image.png", "image/png", []byte{0x89, 'P', 'N', 'G'}); !errors.Is(err, errUnsupportedDocument) || isTransient(err) {
+		t.Errorf("err = %v, want a permanent unsupported document error", err)
+	}
+	if _, err := extractDocument("binary.txt", "", []byte{0xff, 0xfe, 0x00}); err == nil {
+		t.Error("non UTF-8 text should fail")
+	}
+}
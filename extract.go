@@ -0,0 +1,485 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ExtractOptions overrides the automatic main-content detection for the
+// pages of a source
+type ExtractOptions struct {
+	// ContentSelector selects the main content instead of scoring the page
+	ContentSelector string `json:"content_selector,omitempty"`
+	// RemoveSelectors select extra elements to drop before extraction
+	RemoveSelectors []string `json:"remove_selectors,omitempty"`
+}
+
+// Article is the main content of a web page rendered as Markdown
+type Article struct {
+	Title string
+	Text  string
+}
+
+// boilerplateSelector matches elements that never hold the main content
+const boilerplateSelector = `script, style, noscript, template, iframe, object, embed, svg, canvas,
+	form, button, input, select, textarea, nav, footer, aside,
+	[role=navigation], [role=banner], [role=contentinfo], [role=complementary], [aria-hidden=true], [hidden]`
+
+var (
+	unlikelyPattern = regexp.MustCompile(`(?i)comment|sidebar|footer|menu|nav|share|social|sponsor|advert|\bads?\b|banner|cookie|popup|modal|subscribe|newsletter|related|breadcrumb|pagination|widget`)
+	likelyPattern   = regexp.MustCompile(`(?i)article|body|content|entry|main|post|text|story|blog`)
+	spacePattern    = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+)
+
+// extractArticle finds the main content of a page, scoring blocks by text
+// density the way readability does, and renders it as Markdown with
+// headings, lists, tables and code blocks preserved
+func extractArticle(doc *goquery.Document, opts ExtractOptions) Article {
+	article := Article{Title: pageTitle(doc)}
+
+	doc.Find(boilerplateSelector).Remove()
+	// Page headers are boilerplate, article headers usually hold the title
+	doc.Find("header").Not("article header, main header").Remove()
+	for _, selector := range opts.RemoveSelectors {
+		doc.Find(selector).Remove()
+	}
+
+	var roots []*html.Node
+	if opts.ContentSelector != "" {
+		roots = doc.Find(opts.ContentSelector).Nodes
+	} else {
+		removeUnlikely(doc)
+		roots = mainContent(doc)
+	}
+
+	var parts []string
+	for _, root := range roots {
+		parts = append(parts, markdownBlocks(root)...)
+	}
+	article.Text = strings.Join(parts, "\n\n")
+
+	return article
+}
+
+// htmlMarkdown renders an HTML fragment, such as the body of a feed item,
+// as Markdown
+func htmlMarkdown(fragment string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+	if err != nil {
+		return strings.TrimSpace(fragment)
+	}
+	doc.Find(boilerplateSelector).Remove()
+
+	var parts []string
+	for _, body := range doc.Find("body").Nodes {
+		parts = append(parts, markdownBlocks(body)...)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// pageTitle returns the Open Graph title, the <title> or the first heading
+func pageTitle(doc *goquery.Document) string {
+	if title, ok := doc.Find(`meta[property="og:title"]`).Attr("content"); ok && strings.TrimSpace(title) != "" {
+		return strings.TrimSpace(title)
+	}
+	if title := strings.TrimSpace(doc.Find("title").First().Text()); title != "" {
+		return title
+	}
+	return collapseSpace(doc.Find("h1").First().Text())
+}
+
+// removeUnlikely drops elements whose class or id marks them as page chrome
+func removeUnlikely(doc *goquery.Document) {
+	doc.Find("div, section, span, ul, ol, table, p").Each(func(_ int, s *goquery.Selection) {
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyPattern.MatchString(names) && !likelyPattern.MatchString(names) {
+			s.Remove()
+		}
+	})
+}
+
+// mainContent returns the best scoring content block together with the
+// siblings that score nearly as well, in document order
+func mainContent(doc *goquery.Document) []*html.Node {
+	scores := map[*html.Node]float64{}
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+		}
+		scores[n] += score
+	}
+
+	doc.Find("p, pre, td, blockquote, li").Each(func(_ int, s *goquery.Selection) {
+		text := collapseSpace(s.Text())
+		if len(text) < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		parent := s.Nodes[0].Parent
+		addScore(parent, score)
+		if parent != nil {
+			addScore(parent.Parent, score/2)
+		}
+	})
+
+	var best *html.Node
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		scores[n] = score
+		if best == nil || score > scores[best] {
+			best = n
+		}
+	}
+
+	if best == nil {
+		return doc.Find("body").Nodes
+	}
+	if best.Parent == nil {
+		return []*html.Node{best}
+	}
+
+	// Content is often split into sibling blocks, e.g. around an image
+	threshold := max(10, scores[best]*0.2)
+	var nodes []*html.Node
+	for sibling := best.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if sibling == best || scores[sibling] >= threshold || isContentParagraph(sibling) {
+			nodes = append(nodes, sibling)
+		}
+	}
+	return nodes
+}
+
+// initialScore biases a candidate by its tag and class names
+func initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Ol, atom.Ul, atom.Dl, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+
+	names := attr(n, "class") + " " + attr(n, "id")
+	if likelyPattern.MatchString(names) {
+		score += 25
+	}
+	if unlikelyPattern.MatchString(names) {
+		score -= 25
+	}
+	return score
+}
+
+// isContentParagraph reports whether a sibling paragraph of the main block
+// is long enough and light enough on links to be part of the content
+func isContentParagraph(n *html.Node) bool {
+	if n.DataAtom != atom.P {
+		return false
+	}
+	length := len(collapseSpace(nodeText(n)))
+	density := linkDensity(n)
+	return (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(nodeText(n), ". "))
+}
+
+// linkDensity is the share of a node's text that is inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseSpace(nodeText(n)))
+	if total == 0 {
+		return 0
+	}
+
+	var linked int
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linked += len(collapseSpace(nodeText(c)))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return float64(linked) / float64(total)
+}
+
+// markdownBlocks renders a node's children as Markdown blocks
+func markdownBlocks(n *html.Node) []string {
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if text := collapseSpace(inline.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			inline.WriteString(inlineText(c.Data))
+		case c.Type != html.ElementNode:
+		case isBlockElement(c):
+			flush()
+			blocks = append(blocks, markdownBlock(c)...)
+		default:
+			inline.WriteString(inlineMarkdown(c))
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// markdownBlock renders a block element
+func markdownBlock(n *html.Node) []string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := collapseSpace(strings.ReplaceAll(inlineMarkdown(n), "\n", " "))
+		if text == "" {
+			return nil
+		}
+		level := int(n.Data[1] - '0')
+		return []string{strings.Repeat("#", level) + " " + text}
+	case atom.Ul, atom.Ol:
+		if list := markdownList(n, 0); list != "" {
+			return []string{list}
+		}
+		return nil
+	case atom.Pre:
+		code := strings.Trim(nodeText(n), "\n")
+		if strings.TrimSpace(code) == "" {
+			return nil
+		}
+		return []string{"```" + codeLanguage(n) + "\n" + code + "\n```"}
+	case atom.Blockquote:
+		inner := strings.Join(markdownBlocks(n), "\n\n")
+		if inner == "" {
+			return nil
+		}
+		lines := strings.Split(inner, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return []string{strings.Join(lines, "\n")}
+	case atom.Table:
+		if table := markdownTable(n); table != "" {
+			return []string{table}
+		}
+		return nil
+	case atom.Hr:
+		return []string{"---"}
+	default:
+		return markdownBlocks(n)
+	}
+}
+
+// markdownList renders a list, indenting nested lists by depth
+func markdownList(n *html.Node, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	var lines []string
+	number := 1
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		var text strings.Builder
+		var nested []string
+		for c := li.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				text.WriteString(inlineText(c.Data))
+			case c.Type != html.ElementNode:
+			case c.DataAtom == atom.Ul || c.DataAtom == atom.Ol:
+				if list := markdownList(c, depth+1); list != "" {
+					nested = append(nested, list)
+				}
+			case isBlockElement(c):
+				text.WriteString(" " + strings.Join(markdownBlocks(c), " ") + " ")
+			default:
+				text.WriteString(inlineMarkdown(c))
+			}
+		}
+
+		item := collapseSpace(strings.ReplaceAll(text.String(), "\n", " "))
+		if item == "" && len(nested) == 0 {
+			continue
+		}
+		lines = append(lines, indent+marker+item)
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownTable renders a table with its first row as the header
+func markdownTable(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Table:
+				// Nested tables are flattened into their cell
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						text := collapseSpace(strings.ReplaceAll(nodeText(cell), "\n", " "))
+						row = append(row, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+
+	if len(rows) == 0 {
+		return ""
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// inlineMarkdown renders inline content, keeping line breaks and code spans
+func inlineMarkdown(n *html.Node) string {
+	switch {
+	case n.Type == html.TextNode:
+		return inlineText(n.Data)
+	case n.Type != html.ElementNode:
+		return ""
+	case n.DataAtom == atom.Br:
+		return "\n"
+	case n.DataAtom == atom.Code:
+		if code := strings.TrimSpace(nodeText(n)); code != "" {
+			return "`" + code + "`"
+		}
+		return ""
+	case n.DataAtom == atom.Img:
+		return ""
+	case isBlockElement(n):
+		return " " + strings.Join(markdownBlocks(n), " ") + " "
+	}
+
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(inlineMarkdown(c))
+	}
+	return b.String()
+}
+
+// isBlockElement reports whether an element starts a new Markdown block
+func isBlockElement(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Aside,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Ul, atom.Ol, atom.Li, atom.Dl, atom.Dt, atom.Dd,
+		atom.Pre, atom.Blockquote, atom.Table, atom.Figure, atom.Figcaption,
+		atom.Hr, atom.Details, atom.Summary, atom.Address, atom.Body:
+		return true
+	}
+	return false
+}
+
+// codeLanguage reads a "language-x" or "lang-x" class from a <pre> or its <code>
+func codeLanguage(n *html.Node) string {
+	classes := attr(n, "class")
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Code {
+			classes += " " + attr(c, "class")
+		}
+	}
+	for _, class := range strings.Fields(classes) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if lang, ok := strings.CutPrefix(class, prefix); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// inlineText turns source line breaks in flowing text into spaces; only
+// <br> produces a line break
+func inlineText(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// nodeText returns the text of a node and its descendants
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+// attr returns the value of an attribute of a node
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseSpace collapses runs of spaces within lines and drops blank lines
+func collapseSpace(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(spacePattern.ReplaceAllString(line, " ")); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
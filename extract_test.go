@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Site | Fallback title</title>
+  <meta property="og:title" content="Tuning the cache">
+</head>
+<body>
+  <header><a href="/">Home</a> <a href="/blog">Blog</a></header>
+  <nav><ul><li><a href="/a">Archive</a></li><li><a href="/b">About</a></li></ul></nav>
+  <div class="sidebar">Popular posts, tags, and other things that are not the article text.</div>
+  <article class="post">
+    <h1>Tuning the cache</h1>
+    <p>The cache keeps recently used entries in memory, which makes repeated lookups cheap, fast, and predictable.</p>
+    <h2>Settings</h2>
+    <p>Size and expiry can be changed in <code>config.json</code>, and both take effect after a restart of the server.</p>
+    <ul>
+      <li>size: number of entries</li>
+      <li>expiry: seconds
+        <ol><li>zero disables it</li></ol>
+      </li>
+    </ul>
+    <pre><code class="language-json">{
+  "size": 100
+}</code></pre>
+    <table>
+      <tr><th>Key</th><th>Default</th></tr>
+      <tr><td>size</td><td>100</td></tr>
+      <tr><td>expiry</td></tr>
+    </table>
+    <blockquote><p>Measure before tuning.</p></blockquote>
+    <div class="share-buttons">Share this on social networks, and follow us for more content.</div>
+  </article>
+  <footer>Copyright, all rights reserved, and a long footer text that should not be indexed.</footer>
+  <script>track();</script>
+</body>
+</html>`
+
+func parsePage(t *testing.T, page string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("failed to parse page: %v", err)
+	}
+	return doc
+}
+
+func TestExtractArticle(t *testing.T) {
+	article := extractArticle(parsePage(t, articlePage), ExtractOptions{})
+
+	if article.Title != "Tuning the cache" {
+		t.Errorf("title = %q, want the og:title", article.Title)
+	}
+
+	wants := []string{
+		"# Tuning the cache",
+		"## Settings",
+		"changed in `config.json`, and",
+		"- size: number of entries\n- expiry: seconds\n  1. zero disables it",
+		"```json\n{\n  \"size\": 100\n}\n```",
+		"| Key | Default |\n| --- | --- |\n| size | 100 |\n| expiry |  |",
+		"> Measure before tuning.",
+	}
+	for _, want := range wants {
+		if !strings.Contains(article.Text, want) {
+			t.Errorf("article text is missing %q:\n%s", want, article.Text)
+		}
+	}
+
+	for _, unwanted := range []string{"Home", "Archive", "Popular posts", "Share this", "Copyright", "track()"} {
+		if strings.Contains(article.Text, unwanted) {
+			t.Errorf("article text contains boilerplate %q:\n%s", unwanted, article.Text)
+		}
+	}
+}
+
+func TestExtractArticleSelectors(t *testing.T) {
+	opts := ExtractOptions{
+		ContentSelector: "article.post",
+		RemoveSelectors: []string{"table", "pre", ".share-buttons"},
+	}
+	article := extractArticle(parsePage(t, articlePage), opts)
+
+	if !strings.HasPrefix(article.Text, "# Tuning the cache") {
+		t.Errorf("article text should start at the selected element:\n%s", article.Text)
+	}
+	for _, removed := range []string{"| Key |", "```", "Share this"} {
+		if strings.Contains(article.Text, removed) {
+			t.Errorf("removed element %q is still present:\n%s", removed, article.Text)
+		}
+	}
+}
+
+func TestExtractArticleWithoutContentBlocks(t *testing.T) {
+	article := extractArticle(parsePage(t, `<html><body><h1>Short</h1>Just a line.</body></html>`), ExtractOptions{})
+
+	if article.Title != "Short" {
+		t.Errorf("title = %q, want the first heading", article.Title)
+	}
+	if article.Text != "# Short\n\nJust a line." {
+		t.Errorf("text = %q, want the whole body", article.Text)
+	}
+}
+
+func TestCollapseSpace(t *testing.T) {
+	got := collapseSpace("  a \t b\u00a0 c \n\n   \n d  ")
+	if got != "a b c\nd" {
+		t.Errorf("collapseSpace = %q, want %q", got, "a b c\nd")
+	}
+}
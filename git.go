@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// GitOptions select the revision and files of a git source. Patterns are
+// matched against paths in the repository as for directory sources.
+type GitOptions struct {
+	// Ref is a branch or tag, defaulting to the remote's default branch
+	Ref string `json:"ref,omitempty"`
+	// Include defaults to Markdown and source files of known languages
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// gitState is the commit a git source was last fully ingested at
+type gitState struct {
+	SourceID  string    `db:"source_id"`
+	Commit    string    `db:"commit_sha"`
+	Ref       string    `db:"ref"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// gitFile is a file of a commit as listed by git ls-tree
+type gitFile struct {
+	path   string
+	object string
+	size   int64
+}
+
+// isGitRemote reports whether s is a repository git can clone: a local path,
+// a file://, http(s), ssh or git URL, or an scp-like "user@host:path"
+func isGitRemote(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		return false
+	}
+	if filepath.IsAbs(s) {
+		return true
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+		return slices.Contains([]string{"file", "http", "https", "ssh", "git"}, u.Scheme)
+	}
+	// git only reads "user@host:path" as ssh without a slash before the
+	// colon; otherwise it is a local path
+	address, _, ok := strings.Cut(s, ":")
+	user, host, hasUser := strings.Cut(address, "@")
+	return ok && hasUser && user != "" && host != "" && !strings.Contains(address, "/")
+}
+
+// gitLocalPath returns the path of a local path or file:// remote
+func gitLocalPath(remote string) (string, bool) {
+	if filepath.IsAbs(remote) {
+		return remote, true
+	}
+	if u, err := url.Parse(remote); err == nil && u.Scheme == "file" {
+		if u.Opaque != "" {
+			return u.Opaque, true
+		}
+		return u.Path, true
+	}
+	return "", false
+}
+
+// syncGitRepository ingests the files of a git source at its ref. After the
+// first run only files changed since the last ingested commit are read;
+// documents of deleted files are removed.
+func (i *Ingester) syncGitRepository(ctx context.Context, source Source, stats *RunStats) error {
+	opts := source.Options.git()
+	repo := filepath.Join(i.cfg.Sources.GitDir, source.ID)
+	if err := mirrorRepository(ctx, source.URL, repo); err != nil {
+		return err
+	}
+
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := runGit(ctx, repo, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return permanent(fmt.Errorf("ref %q not found in %s", ref, source.URL))
+	}
+	commit = strings.TrimSpace(commit)
+
+	state, err := i.loadGitState(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.Commit == commit && state.Ref == opts.Ref {
+		stats.NotModified = true
+		return nil
+	}
+
+	files, err := gitFiles(ctx, repo, commit)
+	if err != nil {
+		return err
+	}
+
+	// Without a usable previous commit every file is read, otherwise only
+	// the files that differ from it
+	var changed map[string]bool
+	if state != nil && state.Ref == opts.Ref {
+		if _, err := runGit(ctx, repo, "cat-file", "-e", state.Commit+"^{commit}"); err == nil {
+			changed, err = gitChangedFiles(ctx, repo, state.Commit, commit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var keep []string
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		language, ok := gitFileLanguage(file.path, opts)
+		if !ok {
+			continue
+		}
+		keep = append(keep, documentID(source.ID, file.path))
+		if changed != nil && !changed[file.path] {
+			continue
+		}
+
+		stats.ItemsFetched++
+		content, err := readGitFile(ctx, repo, file, language)
+		if errors.Is(err, errNoText) {
+			continue
+		}
+		if err != nil {
+			stats.addFailure(file.path, err)
+			continue
+		}
+		content.Source = source.URL
+		content.Metadata["repository"] = source.URL
+		content.Metadata["commit"] = commit
+		if opts.Ref != "" {
+			content.Metadata["ref"] = opts.Ref
+		}
+		i.indexContent(ctx, source, content, stats)
+	}
+
+	if stats.DocumentsFailed > 0 && stats.indexed() == 0 {
+		return nil
+	}
+	removed, err := db.DeleteMissingDocuments(ctx, source.ID, keep)
+	if err != nil {
+		return err
+	}
+	stats.DocumentsRemoved = removed
+
+	// Files that failed are read again next run by diffing from the old commit
+	if stats.DocumentsFailed > 0 {
+		return nil
+	}
+	return i.saveGitState(ctx, &gitState{SourceID: source.ID, Commit: commit, Ref: opts.Ref})
+}
+
+// mirrorRepository clones a bare mirror of a repository, or fetches into an
+// existing one
+func mirrorRepository(ctx context.Context, remote, repo string) error {
+	if _, err := os.Stat(filepath.Join(repo, "HEAD")); err == nil {
+		if _, err := runGit(ctx, repo, "remote", "set-url", "origin", remote); err != nil {
+			return err
+		}
+		_, err := runGit(ctx, repo, "fetch", "--prune", "--force", "--quiet", "origin")
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(repo), 0o755); err != nil {
+		return fmt.Errorf("failed to create git directory: %w", err)
+	}
+	_, err := runGit(ctx, "", "clone", "--mirror", "--quiet", "--", remote, repo)
+	return err
+}
+
+// gitFiles lists the regular files of a commit
+func gitFiles(ctx context.Context, repo, commit string) ([]gitFile, error) {
+	out, err := runGit(ctx, repo, "ls-tree", "-r", "-z", "--long", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []gitFile
+	for _, entry := range strings.Split(out, "\x00") {
+		// <mode> <type> <object> <size>\t<path>
+		meta, filePath, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, gitFile{path: filePath, object: fields[2], size: size})
+	}
+	return files, nil
+}
+
+// gitChangedFiles returns the paths that differ between two commits
+func gitChangedFiles(ctx context.Context, repo, from, to string) (map[string]bool, error) {
+	out, err := runGit(ctx, repo, "diff", "--name-only", "-z", "--no-renames", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			changed[name] = true
+		}
+	}
+	return changed, nil
+}
+
+// gitFileLanguage returns the language of a file the source includes
+func gitFileLanguage(filePath string, opts GitOptions) (string, bool) {
+	ext := strings.ToLower(path.Ext(filePath))
+	language := codeLanguages[ext]
+	if ext == ".md" || ext == ".markdown" {
+		language = "markdown"
+	}
+
+	for _, pattern := range opts.Exclude {
+		if matchGlob(pattern, filePath) {
+			return "", false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return language, language != ""
+	}
+	for _, pattern := range opts.Include {
+		if matchGlob(pattern, filePath) {
+			if language == "" {
+				language = "text"
+			}
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// readGitFile reads a file of a commit as content. Binary files and files
+// larger than maxDocumentSize are skipped with errNoText.
+func readGitFile(ctx context.Context, repo string, file gitFile, language string) (Content, error) {
+	if file.size > maxDocumentSize || file.size == 0 {
+		return Content{}, errNoText
+	}
+	data, err := runGit(ctx, repo, "cat-file", "blob", file.object)
+	if err != nil {
+		return Content{}, err
+	}
+	if !utf8.ValidString(data) || strings.ContainsRune(data, 0) {
+		return Content{}, errNoText
+	}
+
+	content := Content{
+		ID:          file.path,
+		Title:       file.path,
+		Text:        data,
+		PublishedAt: time.Now(),
+		Language:    language,
+		Metadata:    Metadata{"path": file.path, "language": language},
+	}
+	if language == "markdown" {
+		markdown, err := textContent(file.path, []byte(data))
+		if err != nil {
+			return Content{}, err
+		}
+		content.Title = markdown.Title
+		content.Text = markdown.Text
+	}
+	if strings.TrimSpace(content.Text) == "" {
+		return Content{}, errNoText
+	}
+	return content, nil
+}
+
+// runGit runs a git command in repo and returns its output
+func runGit(ctx context.Context, repo string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repo
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// loadGitState returns the last ingested commit of a source, or nil
+func (i *Ingester) loadGitState(ctx context.Context, sourceID string) (*gitState, error) {
+	query := `SELECT source_id, commit_sha, ref, updated_at FROM git_state WHERE source_id = $1`
+
+	var state gitState
+	err := i.db.GetContext(ctx, &state, query, sourceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load git state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveGitState records the commit a source was ingested at
+func (i *Ingester) saveGitState(ctx context.Context, state *gitState) error {
+	query := `
+		INSERT INTO git_state (source_id, commit_sha, ref, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (source_id) DO UPDATE
+		SET commit_sha = EXCLUDED.commit_sha,
+			ref = EXCLUDED.ref,
+			updated_at = CURRENT_TIMESTAMP`
+
+	if _, err := i.db.ExecContext(ctx, query, state.SourceID, state.Commit, state.Ref); err != nil {
+		return fmt.Errorf("failed to save git state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestIsGitRemote(t *testing.T) {
+	tests := map[string]bool{
+		"https://github.com/example/project.git": true,
+		"ssh://git@example.com:2222/project.git": true,
+		"git://example.com/project.git":          true,
+		"file:///srv/repos/project.git":          true,
+		"/srv/repos/project":                     true,
+		"git@github.com:example/project.git":     true,
+		"relative/project":                       false,
+		"a@./escape:project":                     false,
+		"ext::sh -c touch% /tmp/x":               false,
+		"--upload-pack=touch /tmp/x":             false,
+		"ftp://example.com/project.git":          false,
+		"example.com:project.git":                false,
+	}
+	for remote, want := range tests {
+		if got := isGitRemote(remote); got != want {
+			t.Errorf("isGitRemote(%q) = %v, want %v", remote, got, want)
+		}
+	}
+}
+
+func TestGitLocalPath(t *testing.T) {
+	tests := []struct {
+		remote string
+		path   string
+		local  bool
+	}{
+		{"/srv/repos/project", "/srv/repos/project", true},
+		{"file:///srv/repos/project.git", "/srv/repos/project.git", true},
+		{"file://localhost/srv/repos/project.git", "/srv/repos/project.git", true},
+		{"https://github.com/example/project.git", "", false},
+		{"git@github.com:example/project.git", "", false},
+	}
+	for _, tt := range tests {
+		path, local := gitLocalPath(tt.remote)
+		if path != tt.path || local != tt.local {
+			t.Errorf("gitLocalPath(%s) = %q, %v; want %q, %v", tt.remote, path, local, tt.path, tt.local)
+		}
+	}
+}
+
+func TestGitFileLanguage(t *testing.T) {
+	tests := []struct {
+		path     string
+		opts     GitOptions
+		language string
+		ok       bool
+	}{
+		{"main.go", GitOptions{}, "go", true},
+		{"docs/README.md", GitOptions{}, "markdown", true},
+		{"assets/logo.png", GitOptions{}, "", false},
+		{"LICENSE", GitOptions{}, "", false},
+		{"vendor/lib/lib.go", GitOptions{Exclude: []string{"vendor/**"}}, "", false},
+		{"main_test.go", GitOptions{Exclude: []string{"**/*_test.go"}}, "", false},
+		{"LICENSE", GitOptions{Include: []string{"LICENSE", "*.go"}}, "text", true},
+		{"cmd/main.go", GitOptions{Include: []string{"LICENSE", "*.go"}}, "go", true},
+		{"docs/README.md", GitOptions{Include: []string{"*.go"}}, "", false},
+	}
+	for _, tt := range tests {
+		language, ok := gitFileLanguage(tt.path, tt.opts)
+		if language != tt.language || ok != tt.ok {
+			t.Errorf("gitFileLanguage(%s, %+v) = %q, %v; want %q, %v", tt.path, tt.opts, language, ok, tt.language, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Outcomes of indexing a document
+const (
+	IndexAdded     = "added"
+	IndexUpdated   = "updated"
+	IndexUnchanged = "unchanged"
+)
+
+// IndexContent splits content into chunks, embeds every chunk and stores
+// them as rows linked to docID, replacing the previous version of the
+// document. Content whose hash matches the stored version is skipped without
+// embedding. It returns the outcome and the number of chunks stored.
+func (db *DB) IndexContent(ctx context.Context, docID string, content Content) (string, int, error) {
+	hash := contentHash(content)
+	previous, exists, err := db.DocumentHash(ctx, docID)
+	if err != nil {
+		return "", 0, err
+	}
+	if exists && previous == hash {
+		return IndexUnchanged, 0, nil
+	}
+
+	chunks := chunkerFor(content.Language, db.cfg.Chunking).Split(content.Text)
+	if len(chunks) == 0 {
+		return "", 0, fmt.Errorf("document %s has no text to index", docID)
+	}
+
+	docChunks := make([]DocumentChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		embedding, err := embedder.Embed(ctx, chunk.Text)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to embed chunk %d of %s: %w", chunk.Index, docID, err)
+		}
+		docChunks = append(docChunks, DocumentChunk{Chunk: chunk, Embedding: embedding})
+	}
+
+	if err := db.ReplaceDocumentChunks(ctx, docID, hash, content, docChunks); err != nil {
+		return "", 0, err
+	}
+
+	if exists {
+		return IndexUpdated, len(docChunks), nil
+	}
+	return IndexAdded, len(docChunks), nil
+}
+
+// contentHash fingerprints the indexed parts of a document
+func contentHash(content Content) string {
+	h := sha256.New()
+	for _, part := range []string{content.Title, content.URL, strings.Join(content.Tags, ","), content.Text} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// documentID derives a stable document ID from a source and the identity
+// of an item within it, so refreshes update documents instead of adding
+// duplicates
+func documentID(sourceID, itemID string) string {
+	sum := sha256.Sum256([]byte(itemID))
+	return fmt.Sprintf("%s-%s", sourceID, hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentID(t *testing.T) {
+	id := documentID("rss-1", "https://example.com/post")
+	if !strings.HasPrefix(id, "rss-1-") || len(id) != len("rss-1-")+16 {
+		t.Errorf("documentID = %q, want the source ID and a short hash", id)
+	}
+	if again := documentID("rss-1", "https://example.com/post"); again != id {
+		t.Errorf("documentID is not stable: %q and %q", id, again)
+	}
+	if other := documentID("rss-1", "https://example.com/other"); other == id {
+		t.Error("different items should have different IDs")
+	}
+	if other := documentID("rss-2", "https://example.com/post"); other == id {
+		t.Error("the same item of different sources should have different IDs")
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	base := Content{Title: "Title", URL: "https://example.com/", Tags: []string{"a", "b"}, Text: "text", Metadata: Metadata{"author": "me"}}
+	hash := contentHash(base)
+
+	unchanged := base
+	unchanged.Metadata = Metadata{"author": "someone else"}
+	unchanged.Source = "other feed"
+	if contentHash(unchanged) != hash {
+		t.Error("metadata and source should not change the hash")
+	}
+
+	changes := map[string]func(*Content){
+		"title": func(c *Content) { c.Title = "Other" },
+		"url":   func(c *Content) { c.URL = "https://example.com/other" },
+		"tags":  func(c *Content) { c.Tags = []string{"a"} },
+		"text":  func(c *Content) { c.Text = "other text" },
+	}
+	for name, change := range changes {
+		changed := base
+		change(&changed)
+		if contentHash(changed) == hash {
+			t.Errorf("changing the %s should change the hash", name)
+		}
+	}
+
+	// Parts are separated, so text can't move between them unnoticed
+	if contentHash(Content{Title: "ab"}) == contentHash(Content{Title: "a", URL: "b"}) {
+		t.Error("moving text from the title to the URL should change the hash")
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	tests := []struct {
+		content Content
+		want    string
+	}{
+		{Content{ID: "guid-1", URL: "https://example.com/a", Title: "A"}, "guid-1"},
+		{Content{URL: "https://example.com/a", Title: "A"}, "https://example.com/a"},
+		{Content{Title: "A"}, "A"},
+	}
+	for _, tt := range tests {
+		if got := contentKey(tt.content); got != tt.want {
+			t.Errorf("contentKey(%+v) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pagination styles of JSON APIs
+const (
+	PaginationCursor = "cursor"
+	PaginationPage   = "page"
+	PaginationLink   = "link"
+)
+
+// Authentication schemes of JSON APIs
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+)
+
+// defaultAPIPages bounds the number of pages fetched per run
+const defaultAPIPages = 10
+
+// sourceSecretPrefix is the prefix of the environment variables that header
+// and auth values may reference. No other variables are expanded, so a
+// source can't send the server's own secrets to an arbitrary URL.
+const sourceSecretPrefix = "SOURCE_SECRET_"
+
+// redactedSecret replaces auth tokens and passwords in API responses
+const redactedSecret = "********"
+
+// APIOptions map the JSON responses of an API source to documents. Paths
+// use a JSONPath-like syntax such as "$.data.items[*]" or "author.name".
+// Header and auth values may reference environment variables named
+// SOURCE_SECRET_* as ${SOURCE_SECRET_NAME} to keep secrets out of the
+// database.
+type APIOptions struct {
+	// Items selects the array of items; the whole response is one item
+	// when unset, or every element when the response is an array
+	Items      string            `json:"items,omitempty"`
+	Fields     APIFields         `json:"fields"`
+	Pagination *APIPagination    `json:"pagination,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Auth       *APIAuth          `json:"auth,omitempty"`
+}
+
+// APIFields are the paths of item fields, relative to the item
+type APIFields struct {
+	ID        string            `json:"id,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Body      []string          `json:"body,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Timestamp string            `json:"timestamp,omitempty"`
+	Tags      string            `json:"tags,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// APIPagination describes how to request the following pages
+type APIPagination struct {
+	Type string `json:"type"`
+	// Cursor pagination reads the next cursor from CursorPath in the
+	// response and sends it as the CursorParam query parameter
+	CursorPath  string `json:"cursor_path,omitempty"`
+	CursorParam string `json:"cursor_param,omitempty"`
+	// Page pagination counts PageParam up from StartPage until a page has
+	// no items
+	PageParam string `json:"page_param,omitempty"`
+	StartPage int    `json:"start_page,omitempty"`
+	// Link pagination follows the rel="next" URL of the Link header
+	MaxPages int `json:"max_pages,omitempty"`
+}
+
+// APIAuth sets credentials on API requests
+type APIAuth struct {
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// validate checks the paths, pagination and auth settings
+func (o APIOptions) validate() error {
+	paths := []string{o.Items, o.Fields.ID, o.Fields.Title, o.Fields.URL, o.Fields.Timestamp, o.Fields.Tags}
+	paths = append(paths, o.Fields.Body...)
+	for _, p := range o.Fields.Metadata {
+		paths = append(paths, p)
+	}
+
+	if p := o.Pagination; p != nil {
+		switch p.Type {
+		case PaginationCursor:
+			if p.CursorPath == "" || p.CursorParam == "" {
+				return fmt.Errorf("cursor pagination needs cursor_path and cursor_param")
+			}
+			paths = append(paths, p.CursorPath)
+		case PaginationPage:
+			if p.PageParam == "" {
+				return fmt.Errorf("page pagination needs page_param")
+			}
+		case PaginationLink:
+		default:
+			return fmt.Errorf("unknown pagination type %q", p.Type)
+		}
+		if p.MaxPages < 0 {
+			return fmt.Errorf("pagination max_pages must not be negative")
+		}
+	}
+
+	for _, p := range paths {
+		if _, err := parseJSONPath(p); err != nil {
+			return err
+		}
+	}
+
+	var values []string
+	for _, value := range o.Headers {
+		values = append(values, value)
+	}
+	if a := o.Auth; a != nil {
+		values = append(values, a.Token, a.Username, a.Password)
+	}
+	for _, value := range values {
+		if err := checkSecretReferences(value); err != nil {
+			return err
+		}
+	}
+
+	if a := o.Auth; a != nil {
+		switch a.Type {
+		case AuthBearer:
+			if a.Token == "" {
+				return fmt.Errorf("bearer auth needs a token")
+			}
+		case AuthBasic:
+			if a.Username == "" {
+				return fmt.Errorf("basic auth needs a username")
+			}
+		default:
+			return fmt.Errorf("unknown auth type %q", a.Type)
+		}
+	}
+
+	return nil
+}
+
+// redacted returns the auth with its token and password masked
+func (a APIAuth) redacted() APIAuth {
+	if a.Token != "" {
+		a.Token = redactedSecret
+	}
+	if a.Password != "" {
+		a.Password = redactedSecret
+	}
+	return a
+}
+
+// restoreSecrets keeps the stored token and password where an update sends
+// back the masked values it was given
+func (a *APIAuth) restoreSecrets(stored *APIAuth) {
+	if stored == nil {
+		return
+	}
+	if a.Token == redactedSecret {
+		a.Token = stored.Token
+	}
+	if a.Password == redactedSecret {
+		a.Password = stored.Password
+	}
+}
+
+// checkSecretReferences rejects references to environment variables outside
+// the SOURCE_SECRET_ prefix
+func checkSecretReferences(value string) error {
+	var err error
+	os.Expand(value, func(name string) string {
+		if err == nil && !strings.HasPrefix(name, sourceSecretPrefix) {
+			err = fmt.Errorf("environment variable %q can't be referenced, only %s* variables can", name, sourceSecretPrefix)
+		}
+		return ""
+	})
+	return err
+}
+
+// expandSecrets replaces ${SOURCE_SECRET_*} references with the values of
+// those environment variables; other references expand to nothing
+func expandSecrets(value string) string {
+	return os.Expand(value, func(name string) string {
+		if !strings.HasPrefix(name, sourceSecretPrefix) {
+			return ""
+		}
+		return os.Getenv(name)
+	})
+}
+
+// setAPIHeaders sets the configured headers and auth on a request
+func setAPIHeaders(req *http.Request, opts APIOptions) {
+	req.Header.Set("Accept", "application/json")
+	for name, value := range opts.Headers {
+		req.Header.Set(name, expandSecrets(value))
+	}
+
+	if a := opts.Auth; a != nil {
+		switch a.Type {
+		case AuthBearer:
+			req.Header.Set("Authorization", "Bearer "+expandSecrets(a.Token))
+		case AuthBasic:
+			req.SetBasicAuth(expandSecrets(a.Username), expandSecrets(a.Password))
+		}
+	}
+}
+
+// nextPageURL returns the URL of the page after the current one, or "" when
+// there are no more pages
+func nextPageURL(opts APIOptions, current *url.URL, resp *http.Response, data interface{}, items, page int) string {
+	p := opts.Pagination
+	if p == nil {
+		return ""
+	}
+
+	switch p.Type {
+	case PaginationCursor:
+		cursor := jsonString(firstMatch(data, p.CursorPath))
+		if cursor == "" {
+			return ""
+		}
+		return withQuery(current, p.CursorParam, cursor)
+	case PaginationPage:
+		if items == 0 {
+			return ""
+		}
+		return withQuery(current, p.PageParam, strconv.Itoa(p.StartPage+page))
+	case PaginationLink:
+		next := linkNext(resp.Header.Values("Link"))
+		if next == "" {
+			return ""
+		}
+		if u, err := current.Parse(next); err == nil {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// firstPageURL applies the start page of page pagination to the source URL
+func firstPageURL(opts APIOptions, sourceURL string) string {
+	p := opts.Pagination
+	if p == nil || p.Type != PaginationPage {
+		return sourceURL
+	}
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return sourceURL
+	}
+	return withQuery(u, p.PageParam, strconv.Itoa(p.StartPage))
+}
+
+// withQuery returns u with a query parameter set
+func withQuery(u *url.URL, name, value string) string {
+	next := *u
+	query := next.Query()
+	query.Set(name, value)
+	next.RawQuery = query.Encode()
+	return next.String()
+}
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?([^",]*)"?`)
+
+// linkNext returns the rel="next" target of Link headers
+func linkNext(headers []string) string {
+	for _, header := range headers {
+		for _, match := range linkPattern.FindAllStringSubmatch(header, -1) {
+			for _, rel := range strings.Fields(match[2]) {
+				if strings.EqualFold(rel, "next") {
+					return match[1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// decodeJSON decodes a response body keeping numbers exact
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// apiItems selects the items of a response
+func apiItems(data interface{}, opts APIOptions) []interface{} {
+	if opts.Items != "" {
+		matches := matchJSONPath(data, opts.Items)
+		// A path to an array selects its elements
+		if len(matches) == 1 {
+			if items, ok := matches[0].([]interface{}); ok {
+				return items
+			}
+		}
+		return matches
+	}
+	if items, ok := data.([]interface{}); ok {
+		return items
+	}
+	return []interface{}{data}
+}
+
+// apiContent maps an item to content. Items that have neither an ID nor a
+// URL are identified by a hash of the item.
+func apiContent(item interface{}, fields APIFields, sourceURL string) Content {
+	content := Content{
+		ID:          jsonString(firstMatch(item, fields.ID)),
+		Title:       jsonString(firstMatch(item, fields.Title)),
+		URL:         jsonString(firstMatch(item, fields.URL)),
+		Source:      sourceURL,
+		PublishedAt: time.Now(),
+	}
+
+	if len(fields.Body) == 0 {
+		content.Text = renderJSON(item)
+	} else {
+		var parts []string
+		for _, path := range fields.Body {
+			for _, value := range matchJSONPath(item, path) {
+				if text := strings.TrimSpace(jsonString(value)); text != "" {
+					parts = append(parts, text)
+				}
+			}
+		}
+		content.Text = strings.Join(parts, "\n\n")
+	}
+
+	if fields.Timestamp != "" {
+		if t, ok := parseTimestamp(firstMatch(item, fields.Timestamp)); ok {
+			content.PublishedAt = t
+		}
+	}
+	if fields.Tags != "" {
+		for _, value := range matchJSONPath(item, fields.Tags) {
+			if tags, ok := value.([]interface{}); ok {
+				for _, tag := range tags {
+					content.Tags = append(content.Tags, jsonString(tag))
+				}
+			} else if tag := jsonString(value); tag != "" {
+				content.Tags = append(content.Tags, tag)
+			}
+		}
+	}
+	if len(fields.Metadata) > 0 {
+		content.Metadata = Metadata{}
+		for key, path := range fields.Metadata {
+			if value := firstMatch(item, path); value != nil {
+				content.Metadata[key] = value
+			}
+		}
+	}
+
+	if content.Title == "" {
+		content.Title = fmt.Sprintf("API Data from %s", sourceURL)
+	}
+	if content.ID == "" && content.URL == "" {
+		content.ID = itemHash(item)
+	}
+	return content
+}
+
+// itemHash identifies an item without an ID or URL by its content, which
+// unlike its position stays the same across pages and runs
+func itemHash(item interface{}) string {
+	data, _ := json.Marshal(item)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parseTimestamp reads RFC 3339 and similar dates or Unix seconds/milliseconds
+func parseTimestamp(value interface{}) (time.Time, bool) {
+	if n, ok := value.(json.Number); ok {
+		seconds, err := n.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		if seconds > 1e12 {
+			return time.UnixMilli(int64(seconds)), true
+		}
+		return time.Unix(int64(seconds), 0), true
+	}
+
+	s := strings.TrimSpace(jsonString(value))
+	for _, layout := range []string{time.RFC3339Nano, time.RFC1123Z, time.RFC1123, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// renderJSON renders a JSON value as readable "path: value" lines
+func renderJSON(value interface{}) string {
+	var lines []string
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				path := key
+				if prefix != "" {
+					path = prefix + "." + key
+				}
+				walk(path, v[key])
+			}
+		case []interface{}:
+			for i, element := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), element)
+			}
+		case nil:
+		default:
+			if prefix == "" {
+				lines = append(lines, jsonString(v))
+			} else {
+				lines = append(lines, prefix+": "+jsonString(v))
+			}
+		}
+	}
+	walk("", value)
+	return strings.Join(lines, "\n")
+}
+
+// jsonString converts a scalar JSON value to text and other values to JSON
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+// jsonPathStep is one step of a path: an object key, an array index, or
+// every array element when wildcard is set
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+var jsonPathToken = regexp.MustCompile(`^([^.\[\]]*)((?:\[(?:\d+|\*)\])*)$`)
+
+// parseJSONPath parses paths such as "$.data.items[*].title" or "items[0]"
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, nil
+	}
+
+	var steps []jsonPathStep
+	for _, part := range strings.Split(path, ".") {
+		match := jsonPathToken.FindStringSubmatch(part)
+		if match == nil || (match[1] == "" && match[2] == "") {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+		if match[1] == "*" {
+			steps = append(steps, jsonPathStep{wildcard: true})
+		} else if match[1] != "" {
+			steps = append(steps, jsonPathStep{key: match[1]})
+		}
+		for _, index := range regexp.MustCompile(`\[(\d+|\*)\]`).FindAllStringSubmatch(match[2], -1) {
+			if index[1] == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+				continue
+			}
+			n, _ := strconv.Atoi(index[1])
+			steps = append(steps, jsonPathStep{index: n, isIndex: true})
+		}
+	}
+	return steps, nil
+}
+
+// matchJSONPath returns every value the path selects
+func matchJSONPath(data interface{}, path string) []interface{} {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil
+	}
+
+	current := []interface{}{data}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range current {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, element := range v {
+						next = append(next, element)
+					}
+				} else if element, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, element)
+				}
+			case []interface{}:
+				switch {
+				case step.wildcard:
+					next = append(next, v...)
+				case step.isIndex && step.index < len(v):
+					next = append(next, v[step.index])
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// firstMatch returns the first value the path selects, or nil. An empty
+// path selects nothing.
+func firstMatch(data interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	if matches := matchJSONPath(data, path); len(matches) > 0 {
+		return matches[0]
+	}
+	return nil
+}
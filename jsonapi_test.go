@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func mustDecodeJSON(t *testing.T, body string) interface{} {
+	t.Helper()
+	data, err := decodeJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("invalid JSON %s: %v", body, err)
+	}
+	return data
+}
+
+func TestMatchJSONPath(t *testing.T) {
+	data := mustDecodeJSON(t, `{
+		"data": {
+			"items": [
+				{"title": "first", "tags": ["a", "b"]},
+				{"title": "second"}
+			]
+		},
+		"count": 2
+	}`)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"$.data.items[*].title", []string{"first", "second"}},
+		{"data.items[1].title", []string{"second"}},
+		{"data.items[0].tags[*]", []string{"a", "b"}},
+		{"$.count", []string{"2"}},
+		{"data.items[5].title", nil},
+		{"data.missing", nil},
+		{"count.title", nil},
+		{"data[0]", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, value := range matchJSONPath(data, tt.path) {
+			got = append(got, jsonString(value))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchJSONPath(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if got := matchJSONPath(data, "$"); len(got) != 1 || !reflect.DeepEqual(got[0], data) {
+		t.Errorf("matchJSONPath($) = %v, want the whole document", got)
+	}
+	if got := firstMatch(data, ""); got != nil {
+		t.Errorf("firstMatch with an empty path = %v, want nil", got)
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	for _, path := range []string{"a..b", "items[x]", "items[", "a]b"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("parseJSONPath(%q) should fail", path)
+		}
+	}
+}
+
+func TestExpandSecrets(t *testing.T) {
+	t.Setenv("SOURCE_SECRET_TOKEN", "s3cret")
+	t.Setenv("DATABASE_PASSWORD", "db-password")
+
+	if got := expandSecrets("Bearer ${SOURCE_SECRET_TOKEN}"); got != "Bearer s3cret" {
+		t.Errorf("expandSecrets = %q, want the secret", got)
+	}
+	if got := expandSecrets("${DATABASE_PASSWORD}$HOME"); got != "" {
+		t.Errorf("expandSecrets = %q, want other variables left out", got)
+	}
+
+	if err := checkSecretReferences("key ${SOURCE_SECRET_TOKEN}"); err != nil {
+		t.Errorf("checkSecretReferences: %v", err)
+	}
+	for _, value := range []string{"${DATABASE_PASSWORD}", "$HOME", "${SOURCE_SECRET_TOKEN}:${PATH}"} {
+		if err := checkSecretReferences(value); err == nil {
+			t.Errorf("checkSecretReferences(%q) should fail", value)
+		}
+	}
+
+	opts := APIOptions{Auth: &APIAuth{Type: AuthBearer, Token: "${DATABASE_PASSWORD}"}}
+	if err := opts.validate(); err == nil {
+		t.Error("validate should reject a token referencing another variable")
+	}
+}
+
+func TestSourceOptionsRedacted(t *testing.T) {
+	stored := SourceOptions{API: &APIOptions{Auth: &APIAuth{Type: AuthBasic, Username: "user", Password: "p4ss"}}}
+
+	redacted := stored.redacted()
+	if redacted.API.Auth.Password != redactedSecret || redacted.API.Auth.Username != "user" {
+		t.Errorf("redacted auth = %+v, want only the password masked", redacted.API.Auth)
+	}
+	if stored.API.Auth.Password != "p4ss" {
+		t.Error("redacted should not change the stored options")
+	}
+
+	// An update sending back the masked password keeps the stored one
+	redacted.restoreSecrets(stored)
+	if !reflect.DeepEqual(redacted, stored) {
+		t.Errorf("restored auth = %+v, want %+v", redacted.API.Auth, stored.API.Auth)
+	}
+
+	changed := SourceOptions{API: &APIOptions{Auth: &APIAuth{Type: AuthBasic, Username: "user", Password: "new"}}}
+	changed.restoreSecrets(stored)
+	if changed.API.Auth.Password != "new" {
+		t.Error("restoreSecrets should keep a new password")
+	}
+}
+
+func TestAPIContent(t *testing.T) {
+	fields := APIFields{
+		Title:     "name",
+		Body:      []string{"summary", "notes[*]"},
+		Timestamp: "updated",
+		Tags:      "labels",
+		Metadata:  map[string]string{"owner": "owner.login"},
+	}
+	item := mustDecodeJSON(t, `{
+		"name": "Release notes",
+		"summary": "What changed",
+		"notes": ["Faster startup", " "],
+		"updated": 1700000000,
+		"labels": ["release", "docs"],
+		"owner": {"login": "maintainer"}
+	}`)
+
+	content := apiContent(item, fields, "https://api.example.com/items")
+	if content.Title != "Release notes" || content.Text != "What changed\n\nFaster startup" {
+		t.Errorf("content = %q: %q", content.Title, content.Text)
+	}
+	if content.PublishedAt.Unix() != 1700000000 {
+		t.Errorf("published at = %v", content.PublishedAt)
+	}
+	if !reflect.DeepEqual(content.Tags, []string{"release", "docs"}) || content.Metadata["owner"] != "maintainer" {
+		t.Errorf("tags = %v, metadata = %v", content.Tags, content.Metadata)
+	}
+
+	// Items without an ID or URL are keyed by their content, whatever page
+	// they appear on
+	same := apiContent(mustDecodeJSON(t, `{"owner": {"login": "maintainer"}, "labels": ["release", "docs"], "notes": ["Faster startup", " "], "summary": "What changed", "updated": 1700000000, "name": "Release notes"}`), fields, "https://api.example.com/items")
+	if !strings.HasPrefix(content.ID, "sha256:") || content.ID != same.ID {
+		t.Errorf("IDs = %q and %q, want the same item hash", content.ID, same.ID)
+	}
+	other := apiContent(mustDecodeJSON(t, `{"name": "Other"}`), fields, "https://api.example.com/items")
+	if other.ID == content.ID {
+		t.Error("different items should have different IDs")
+	}
+
+	withURL := apiContent(mustDecodeJSON(t, `{"link": "https://example.com/a"}`), APIFields{URL: "link"}, "https://api.example.com/items")
+	if withURL.ID != "" || withURL.Title != "API Data from https://api.example.com/items" {
+		t.Errorf("item with a URL: ID = %q, title = %q", withURL.ID, withURL.Title)
+	}
+}
+
+func TestAPIProcessorPagination(t *testing.T) {
+	const pages = 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page > pages {
+			fmt.Fprint(w, `{"results": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"id": "%d-a"}, {"id": "%d-b"}]}`, page, page)
+	}))
+	defer server.Close()
+	t.Setenv("SOURCE_SECRET_TOKEN", "s3cret")
+
+	fetch := func(maxPages int) ([]Content, bool) {
+		t.Helper()
+		opts := APIOptions{
+			Items:      "results",
+			Fields:     APIFields{ID: "id"},
+			Pagination: &APIPagination{Type: PaginationPage, PageParam: "page", StartPage: 1, MaxPages: maxPages},
+			Auth:       &APIAuth{Type: AuthBearer, Token: "${SOURCE_SECRET_TOKEN}"},
+		}
+		processor := &APIProcessor{client: server.Client()}
+		contents, complete, err := processor.Fetch(context.Background(), server.URL+"/items", opts, nil)
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		return contents, complete
+	}
+
+	contents, complete := fetch(0)
+	if len(contents) != 2*pages || !complete {
+		t.Errorf("got %d items, complete = %v; want %d items from every page", len(contents), complete, 2*pages)
+	}
+	if contents[0].ID != "1-a" || contents[len(contents)-1].ID != "3-b" {
+		t.Errorf("items = %q ... %q", contents[0].ID, contents[len(contents)-1].ID)
+	}
+
+	contents, complete = fetch(2)
+	if len(contents) != 4 || complete {
+		t.Errorf("got %d items, complete = %v; want 4 items and an incomplete fetch", len(contents), complete)
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/ledongthuc/pdf"
 	"github.com/mmcdole/gofeed"
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
 	"github.com/robfig/cron/v3" // Add cron package import
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
@@ -21,41 +24,111 @@ import (
 
 // Knowledge source types
 const (
-	SourceTypeAPI     = "api"
-	SourceTypeLink    = "link"
-	SourceTypePDF     = "pdf"
-	SourceTypeYouTube = "youtube"
-	SourceTypeRSS     = "rss"
-	SourceTypeText    = "text"
+	SourceTypeAPI       = "api"
+	SourceTypeLink      = "link"
+	SourceTypePDF       = "pdf"
+	SourceTypeYouTube   = "youtube"
+	SourceTypeRSS       = "rss"
+	SourceTypeText      = "text"
+	SourceTypeCrawl     = "crawl"
+	SourceTypeDirectory = "directory"
+	SourceTypeGit       = "git"
 )
 
+// sourceTypes lists the source types that can be ingested
+var sourceTypes = []string{
+	SourceTypeAPI,
+	SourceTypeLink,
+	SourceTypePDF,
+	SourceTypeYouTube,
+	SourceTypeRSS,
+	SourceTypeText,
+	SourceTypeCrawl,
+	SourceTypeDirectory,
+	SourceTypeGit,
+}
+
 // Source represents a knowledge source configuration
 type Source struct {
-	ID          string    `db:"id"`
-	Type        string    `db:"type"`
-	URL         string    `db:"url"`
-	Schedule    string    `db:"schedule"` // Cron expression
-	LastUpdated time.Time `db:"last_updated"`
-	Active      bool      `db:"active"`
+	ID          string        `db:"id" json:"id"`
+	Type        string        `db:"type" json:"type"`
+	URL         string        `db:"url" json:"url"`
+	Schedule    string        `db:"schedule" json:"schedule"` // Cron expression
+	Options     SourceOptions `db:"options" json:"options"`
+	LastUpdated *time.Time    `db:"last_updated" json:"last_updated"`
+	Active      bool          `db:"active" json:"active"`
+	CreatedAt   time.Time     `db:"created_at" json:"created_at"`
+	NextRun     *time.Time    `db:"-" json:"next_run,omitempty"`
+
+	// Consecutive failed runs; a source that keeps failing is dead-lettered
+	// (deactivated) with the reason of its last failure
+	ConsecutiveFailures int        `db:"consecutive_failures" json:"consecutive_failures"`
+	DeadLetteredAt      *time.Time `db:"dead_lettered_at" json:"dead_lettered_at,omitempty"`
+	DeadLetterReason    string     `db:"dead_letter_reason" json:"dead_letter_reason,omitempty"`
+
+	// HTTP validators of the URLs fetched for the source
+	Cache []CacheEntry `db:"-" json:"cache,omitempty"`
 }
 
-// Content represents processed content from any source
+// redacted returns a copy of the source with credentials masked, for API
+// responses
+func (s Source) redacted() Source {
+	s.Options = s.Options.redacted()
+	return s
+}
+
+// Content represents processed content from any source. ID identifies the
+// item within its source, such as a feed item GUID, and defaults to the URL.
 type Content struct {
+	ID          string
 	Title       string
 	Text        string
 	Source      string
 	URL         string
 	PublishedAt time.Time
+	SourceID    string
+	SourceType  string
+	Tags        []string
+	Metadata    Metadata
+	Locations   []Location
+	// Language is the language of source files, such as "go" or
+	// "markdown", and selects how they are chunked
+	Language string
+	// Err is set for an item that could not be fetched; it is recorded as
+	// a failure and its existing document kept
+	Err error
+}
+
+// Location marks where a part of the text starts in the original, such as
+// a PDF page or a moment of a video. Offset is a character offset into
+// Content.Text and Locations are sorted by it.
+type Location struct {
+	Offset int
+	Label  string
+	URL    string
 }
 
 type Ingester struct {
-	db           *sqlx.DB
-	apiProcessor *APIProcessor
-	webProcessor *WebProcessor
-	pdfProcessor *PDFProcessor
-	ytProcessor  *YouTubeProcessor
-	rssProcessor *RSSProcessor
-	cron         *cron.Cron
+	db            *sqlx.DB
+	cfg           *config.Config
+	apiProcessor  *APIProcessor
+	webProcessor  *WebProcessor
+	pdfProcessor  *PDFProcessor
+	textProcessor *TextProcessor
+	ytProcessor   *YouTubeProcessor
+	rssProcessor  *RSSProcessor
+	cron          *cron.Cron
+
+	// entries maps source IDs to their cron entries; inFlight holds the
+	// sources with a queued or running run
+	mu       sync.Mutex
+	entries  map[string]cron.EntryID
+	inFlight map[string]bool
+
+	// Runs are processed by a pool of SourcesConfig.MaxConcurrent workers
+	queue   chan queuedRun
+	done    chan struct{}
+	workers sync.WaitGroup
 }
 
 // APIProcessor processes REST API endpoints
@@ -63,270 +136,799 @@ type APIProcessor struct {
 	client *http.Client
 }
 
-func (p *APIProcessor) Fetch(url string) ([]Content, error) {
-	resp, err := p.client.Get(url)
-	if err != nil {
-		return nil, err
+// Fetch returns the items of every page of an API source, and whether they
+// are all of them; they aren't when pagination stopped at the page limit.
+func (p *APIProcessor) Fetch(ctx context.Context, url string, opts APIOptions, cache *FetchCache) ([]Content, bool, error) {
+	maxPages := 1
+	if opts.Pagination != nil {
+		maxPages = opts.Pagination.MaxPages
+		if maxPages <= 0 {
+			maxPages = defaultAPIPages
+		}
 	}
-	defer resp.Body.Close()
 
-	var data map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
-	}
+	var contents []Content
+	pageURL := firstPageURL(opts, url)
+	for page := 1; pageURL != "" && page <= maxPages; page++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, false, permanent(fmt.Errorf("error creating request: %w", err))
+		}
+		setAPIHeaders(req, opts)
 
-	// Convert the API response to content
-	// This is a simple example - adjust based on your API structure
-	content := Content{
-		Title:       fmt.Sprintf("API Data from %s", url),
-		Text:        fmt.Sprintf("%v", data),
-		Source:      url,
-		URL:         url,
-		PublishedAt: time.Now(),
+		// Only the first page is fetched conditionally, as an unchanged
+		// first page says nothing about the rest
+		if page > 1 {
+			cache = nil
+		}
+		resp, err := doRequest(p.client, req, cache)
+		if err != nil {
+			return nil, false, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read API response: %w", err)
+		}
+
+		data, err := decodeJSON(body)
+		if err != nil {
+			return nil, false, permanent(fmt.Errorf("failed to decode API response: %w", err))
+		}
+
+		items := apiItems(data, opts)
+		for _, item := range items {
+			contents = append(contents, apiContent(item, opts.Fields, url))
+		}
+		pageURL = nextPageURL(opts, req.URL, resp, data, len(items), page)
 	}
 
-	return []Content{content}, nil
+	return contents, pageURL == "", nil
 }
 
 // WebProcessor processes web links
 type WebProcessor struct {
 	client *http.Client
+	hosts  *hostLimiter
 }
 
-func (p *WebProcessor) Fetch(url string) ([]Content, error) {
-	resp, err := p.client.Get(url)
+func (p *WebProcessor) Fetch(ctx context.Context, url string, opts ExtractOptions, cache *FetchCache) ([]Content, error) {
+	page, err := p.fetchPage(ctx, url, opts, cache, 0)
+	if err != nil {
+		return nil, err
+	}
+	if page.Article.Text == "" {
+		return nil, permanent(fmt.Errorf("no content found on %s", url))
+	}
+
+	return []Content{page.content()}, nil
+}
+
+// webPage is a fetched HTML page with its main content and links
+type webPage struct {
+	URL       string
+	Canonical string
+	Links     []string
+	Article   Article
+}
+
+// fetchPage fetches an HTML page, collects its links and canonical URL and
+// extracts its main content. delay is the minimum time between requests to
+// the page's host.
+func (p *WebProcessor) fetchPage(ctx context.Context, pageURL string, opts ExtractOptions, cache *FetchCache, delay time.Duration) (*webPage, error) {
+	release, err := p.hosts.acquire(ctx, pageURL, delay)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := getURL(ctx, p.client, pageURL, cache)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, permanent(fmt.Errorf("%w: %s", errNotHTML, contentType))
+	}
+
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	// Extract main content
-	var textContent strings.Builder
-	doc.Find("article, main, .content, #content").Each(func(i int, s *goquery.Selection) {
-		textContent.WriteString(s.Text())
+	// Links are collected before extraction strips navigation
+	base := resp.Request.URL
+	page := &webPage{URL: base.String()}
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		if link, err := base.Parse(strings.TrimSpace(s.AttrOr("href", ""))); err == nil {
+			page.Links = append(page.Links, link.String())
+		}
 	})
+	if href, ok := doc.Find(`link[rel="canonical"]`).Attr("href"); ok {
+		if canonical, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			page.Canonical = normalizeURL(canonical)
+		}
+	}
+	page.Article = extractArticle(doc, opts)
 
-	content := Content{
-		Title:       doc.Find("title").Text(),
-		Text:        textContent.String(),
-		Source:      url,
-		URL:         url,
+	return page, nil
+}
+
+// content converts the page into indexable content, identified by its
+// canonical URL when it has one
+func (page *webPage) content() Content {
+	pageURL := page.URL
+	if page.Canonical != "" {
+		pageURL = page.Canonical
+	}
+
+	return Content{
+		Title:       page.Article.Title,
+		Text:        page.Article.Text,
+		Source:      pageURL,
+		URL:         pageURL,
 		PublishedAt: time.Now(),
 	}
+}
 
-	return []Content{content}, nil
+// PDFProcessor processes PDF files from local paths and URLs
+type PDFProcessor struct {
+	client *http.Client
 }
 
-// PDFProcessor processes PDF files
-type PDFProcessor struct{}
+// Fetch reads a PDF from an http(s) URL or a local path
+func (p *PDFProcessor) Fetch(ctx context.Context, location string, cache *FetchCache) ([]Content, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		content, err := p.FetchURL(ctx, location, cache)
+		if err != nil {
+			return nil, err
+		}
+		return []Content{content}, nil
+	}
 
-func (p *PDFProcessor) Fetch(filepath string) ([]Content, error) {
-	f, r, err := pdf.Open(filepath)
+	f, err := os.Open(location)
 	if err != nil {
-		return nil, err
+		return nil, permanent(fmt.Errorf("failed to open PDF: %w", err))
 	}
 	defer f.Close()
 
-	var content strings.Builder
-	totalPage := r.NumPage()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat PDF: %w", err)
+	}
+	r, err := pdf.NewReader(f, info.Size())
+	if err != nil {
+		return nil, openError(err)
+	}
 
-	for pageIndex := 1; pageIndex <= totalPage; pageIndex++ {
-		page := r.Page(pageIndex)
-		if page.V.IsNull() {
-			continue
+	content, err := readPDF(r, location)
+	if err != nil {
+		return nil, err
+	}
+	return []Content{content}, nil
+}
+
+// FetchURL downloads and reads a PDF of at most maxPDFSize bytes
+func (p *PDFProcessor) FetchURL(ctx context.Context, pdfURL string, cache *FetchCache) (Content, error) {
+	resp, err := getURL(ctx, p.client, pdfURL, cache)
+	if err != nil {
+		return Content{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPDFSize+1))
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to download PDF: %w", err)
+	}
+	if len(data) > maxPDFSize {
+		return Content{}, permanent(fmt.Errorf("PDF is larger than %d bytes", maxPDFSize))
+	}
+
+	return pdfData(data, pdfURL)
+}
+
+// TextProcessor processes text documents (plain text, Markdown, HTML, DOCX
+// and CSV) from local paths and URLs
+type TextProcessor struct {
+	client *http.Client
+}
+
+// Fetch reads a document from an http(s) URL or a local path
+func (p *TextProcessor) Fetch(ctx context.Context, location string, cache *FetchCache) ([]Content, error) {
+	var data []byte
+	mediaType := ""
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := getURL(ctx, p.client, location, cache)
+		if err != nil {
+			return nil, err
 		}
-		text, err := page.GetPlainText(nil)
+		defer resp.Body.Close()
+
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to download document: %w", err)
+		}
+		mediaType = resp.Header.Get("Content-Type")
+	} else {
+		var err error
+		data, err = os.ReadFile(location)
+		if err != nil {
+			return nil, permanent(fmt.Errorf("failed to read document: %w", err))
 		}
-		content.WriteString(text)
+	}
+	if len(data) > maxDocumentSize {
+		return nil, permanent(fmt.Errorf("document is larger than %d bytes", maxDocumentSize))
 	}
 
-	return []Content{{
-		Title:       filepath,
-		Text:        content.String(),
-		Source:      filepath,
-		URL:         filepath,
-		PublishedAt: time.Now(),
-	}}, nil
+	content, err := extractDocument(location, mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+	return []Content{content}, nil
 }
 
-// YouTubeProcessor processes YouTube videos using captions/transcripts
+// YouTubeProcessor processes YouTube videos, playlists and channels using
+// their captions
 type YouTubeProcessor struct {
-	service *youtube.Service
+	service      *youtube.Service
+	client       *http.Client
+	timedTextURL string
+	languages    []string
+	maxResults   int
+	quota        *youtubeQuota
 }
 
-func NewYouTubeProcessor(apiKey string) (*YouTubeProcessor, error) {
+func NewYouTubeProcessor(cfg config.YouTubeConfig) (*YouTubeProcessor, error) {
 	ctx := context.Background()
-	service, err := youtube.NewService(ctx, option.WithAPIKey(apiKey))
+	opts := []option.ClientOption{option.WithAPIKey(cfg.APIKey)}
+	if cfg.BaseURL != "" {
+		opts = append(opts, option.WithEndpoint(cfg.BaseURL))
+	}
+	service, err := youtube.NewService(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &YouTubeProcessor{service: service}, nil
+
+	return &YouTubeProcessor{
+		service:      service,
+		client:       &http.Client{Timeout: time.Duration(cfg.RequestTimeout)},
+		timedTextURL: cfg.TimedTextURL,
+		languages:    cfg.Languages,
+		maxResults:   cfg.MaxResults,
+		quota:        &youtubeQuota{limit: cfg.QuotaPerDay},
+	}, nil
 }
 
-func (p *YouTubeProcessor) Fetch(videoID string) ([]Content, error) {
-	// Get video details
-	call := p.service.Videos.List([]string{"snippet"}).Id(videoID)
-	response, err := call.Do()
+// Fetch returns one document per video of a video, playlist or channel
+// source, made of the description and the transcript of the preferred
+// caption track. Transcript locations link to the moment in the video.
+// Playlists and channels are only fetched up to their latest videos, so
+// their contents are never complete, and a video that fails is returned
+// with its error instead of failing the others.
+func (p *YouTubeProcessor) Fetch(ctx context.Context, source string, opts YouTubeOptions) ([]Content, bool, error) {
+	target, err := parseYouTubeTarget(source)
 	if err != nil {
-		return nil, err
+		return nil, false, permanent(err)
 	}
 
-	if len(response.Items) == 0 {
-		return nil, fmt.Errorf("video not found")
+	limit := opts.MaxVideos
+	if limit <= 0 {
+		limit = p.maxResults
+	}
+	languages := opts.Languages
+	if len(languages) == 0 {
+		languages = p.languages
 	}
 
-	video := response.Items[0]
+	ids, err := p.videoIDs(ctx, target, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	videos, err := p.videos(ctx, ids)
+	if err != nil {
+		return nil, false, err
+	}
+	if target.kind == youtubeVideo {
+		if len(videos) == 0 {
+			return nil, false, permanent(fmt.Errorf("video not found"))
+		}
+		content, err := p.videoContent(ctx, videos[0], languages)
+		if err != nil {
+			return nil, false, err
+		}
+		return []Content{content}, true, nil
+	}
 
-	// Get captions (Note: This is simplified - you'll need to implement caption fetching)
-	// You might want to use youtube-dl or a similar tool for actual caption fetching
+	contents := make([]Content, 0, len(videos))
+	for _, video := range videos {
+		content, err := p.videoContent(ctx, video, languages)
+		if err != nil {
+			log.Printf("Error fetching YouTube video %s: %v", video.Id, err)
+			content.Err = err
+		}
+		contents = append(contents, content)
+	}
+	return contents, false, nil
+}
 
+// videoContent builds the document of a video. Videos without captions
+// are indexed by their description. On error the content still identifies
+// the video.
+func (p *YouTubeProcessor) videoContent(ctx context.Context, video *youtube.Video, languages []string) (Content, error) {
 	content := Content{
-		Title:       video.Snippet.Title,
-		Text:        video.Snippet.Description, // In reality, you'd want to add captions here
+		ID:          video.Id,
 		Source:      "youtube",
-		URL:         fmt.Sprintf("https://youtube.com/watch?v=%s", videoID),
+		URL:         watchURL(video.Id, 0),
 		PublishedAt: time.Now(),
+		Metadata:    Metadata{"video_id": video.Id},
+	}
+	if snippet := video.Snippet; snippet != nil {
+		content.Title = snippet.Title
+		content.Text = strings.TrimSpace(snippet.Description)
+		content.Tags = snippet.Tags
+		content.Metadata["channel_id"] = snippet.ChannelId
+		content.Metadata["channel_title"] = snippet.ChannelTitle
+		if published, err := time.Parse(time.RFC3339, snippet.PublishedAt); err == nil {
+			content.PublishedAt = published
+		}
 	}
 
-	return []Content{content}, nil
+	tracks, err := p.captionTracks(ctx, video.Id)
+	if err != nil {
+		return content, err
+	}
+	track, ok := chooseTrack(tracks, languages)
+	if !ok {
+		log.Printf("No captions for YouTube video %s, indexing its description", video.Id)
+		return content, nil
+	}
+	segments, err := p.transcript(ctx, video.Id, track)
+	if err != nil {
+		return content, err
+	}
+
+	prefix := content.Text
+	if prefix != "" {
+		prefix += "\n\nTranscript:"
+	}
+	content.Text, content.Locations = transcriptText(video.Id, prefix, segments)
+	content.Metadata["caption_language"] = track.Language
+	content.Metadata["caption_kind"] = captionManual
+	if track.Kind == captionASR {
+		content.Metadata["caption_kind"] = captionASR
+	}
+	return content, nil
 }
 
-// RSSProcessor processes RSS feeds
+// RSSProcessor processes RSS and Atom feeds
 type RSSProcessor struct {
+	client *http.Client
 	parser *gofeed.Parser
+	web    *WebProcessor
+	pdf    *PDFProcessor
 }
 
-func (p *RSSProcessor) Fetch(feedURL string) ([]Content, error) {
-	feed, err := p.parser.ParseURL(feedURL)
+// Fetch returns the items of a feed that are not in seen, keyed by GUID
+func (p *RSSProcessor) Fetch(ctx context.Context, feedURL string, opts RSSOptions, seen map[string]bool, cache *FetchCache) ([]Content, error) {
+	resp, err := getURL(ctx, p.client, feedURL, cache)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	feed, err := p.parser.Parse(resp.Body)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("failed to parse feed: %w", err))
+	}
 
 	var contents []Content
 	for _, item := range feed.Items {
-		publishedAt := time.Now()
-		if item.PublishedParsed != nil {
-			publishedAt = *item.PublishedParsed
-		}
-
-		content := Content{
-			Title:       item.Title,
-			Text:        item.Description,
-			Source:      feed.Title,
-			URL:         item.Link,
-			PublishedAt: publishedAt,
+		if seen[itemKey(item)] {
+			continue
 		}
-		contents = append(contents, content)
+		content := feedItemContent(feed, item, opts)
+		contents = append(contents, p.enrichItem(ctx, item, content, opts)...)
 	}
 
 	return contents, nil
 }
 
-func NewIngester(db *DB, youtubeAPIKey string) (*Ingester, error) {
-	ytProcessor, err := NewYouTubeProcessor(youtubeAPIKey)
+// userAgent identifies the ingester to the sites it fetches
+const userAgent = robotsAgent + "/1.0"
+
+// getURL sends a GET request and returns the response if its status is 2xx.
+// With a cache the request is conditional and errNotModified is returned
+// when the server answers 304. The caller must close the response body.
+func getURL(ctx context.Context, client *http.Client, url string, cache *FetchCache) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("error creating request: %w", err))
+	}
+	return doRequest(client, req, cache)
+}
+
+// doRequest sends a GET request as getURL does
+func doRequest(client *http.Client, req *http.Request, cache *FetchCache) (*http.Response, error) {
+	url := req.URL.String()
+	req.Header.Set("User-Agent", userAgent)
+	cache.addConditions(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		cache.record(url, resp)
+		return nil, errNotModified
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	cache.record(url, resp)
+
+	return resp, nil
+}
+
+func NewIngester(db *DB) (*Ingester, error) {
+	ytProcessor, err := NewYouTubeProcessor(db.cfg.YouTube)
 	if err != nil {
 		return nil, err
 	}
 
+	hosts := newHostLimiter(db.cfg.Sources.MaxPerHost, time.Duration(db.cfg.Sources.HostDelay))
+	webProcessor := &WebProcessor{client: http.DefaultClient, hosts: hosts}
+	pdfProcessor := &PDFProcessor{client: http.DefaultClient}
+
 	return &Ingester{
-		db:           db.Sdb,
-		apiProcessor: &APIProcessor{client: http.DefaultClient},
-		webProcessor: &WebProcessor{client: http.DefaultClient},
-		pdfProcessor: &PDFProcessor{},
-		ytProcessor:  ytProcessor,
-		rssProcessor: &RSSProcessor{parser: gofeed.NewParser()},
-		cron:         cron.New(cron.WithSeconds()),
+		db:            db.Sdb,
+		cfg:           db.cfg,
+		apiProcessor:  &APIProcessor{client: http.DefaultClient},
+		webProcessor:  webProcessor,
+		pdfProcessor:  pdfProcessor,
+		textProcessor: &TextProcessor{client: http.DefaultClient},
+		ytProcessor:   ytProcessor,
+		rssProcessor:  &RSSProcessor{client: http.DefaultClient, parser: gofeed.NewParser(), web: webProcessor, pdf: pdfProcessor},
+		cron:          cron.New(),
+		entries:       map[string]cron.EntryID{},
+		queue:         make(chan queuedRun),
+		done:          make(chan struct{}),
+		inFlight:      map[string]bool{},
 	}, nil
 }
 
-func (i *Ingester) Start() {
+// Start starts the worker pool and schedules every active source on its own
+// cron schedule
+func (i *Ingester) Start() error {
+	if err := i.failInterruptedRuns(context.Background()); err != nil {
+		return err
+	}
+
+	for n := 0; n < max(i.cfg.Sources.MaxConcurrent, 1); n++ {
+		i.workers.Add(1)
+		go i.worker()
+	}
+
+	sources, err := i.getActiveSources()
+	if err != nil {
+		return fmt.Errorf("failed to get active sources: %w", err)
+	}
+
+	for _, source := range sources {
+		if err := i.scheduleSource(source); err != nil {
+			log.Printf("Error scheduling source %s: %v", source.ID, err)
+		}
+	}
+
 	i.cron.Start()
+	return nil
+}
 
-	// Schedule periodic source checks
-	i.cron.AddFunc("*/15 * * * *", func() { // Every 15 minutes
-		i.processActiveSources()
+// Stop stops the scheduler and waits for running jobs to finish. Runs that
+// are still queued are marked failed on the next start.
+func (i *Ingester) Stop() {
+	<-i.cron.Stop().Done()
+	close(i.done)
+	i.workers.Wait()
+}
+
+// scheduleSource (re)registers the cron entry of a source, falling back to
+// the default schedule. Inactive sources are only unscheduled.
+func (i *Ingester) scheduleSource(source Source) error {
+	i.unscheduleSource(source.ID)
+	if !source.Active {
+		return nil
+	}
+
+	schedule := source.Schedule
+	if schedule == "" {
+		schedule = i.cfg.Sources.DefaultSchedule
+	}
+
+	sourceID := source.ID
+	entryID, err := i.cron.AddFunc(schedule, func() {
+		i.processScheduledSource(sourceID)
 	})
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+
+	i.mu.Lock()
+	i.entries[source.ID] = entryID
+	i.mu.Unlock()
+
+	return nil
 }
 
-func (i *Ingester) Stop() {
-	i.cron.Stop()
+// unscheduleSource removes the cron entry of a source, if any
+func (i *Ingester) unscheduleSource(sourceID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if entryID, ok := i.entries[sourceID]; ok {
+		i.cron.Remove(entryID)
+		delete(i.entries, sourceID)
+	}
+}
+
+// nextRun returns the next scheduled run of a source, or nil if it isn't scheduled
+func (i *Ingester) nextRun(sourceID string) *time.Time {
+	i.mu.Lock()
+	entryID, ok := i.entries[sourceID]
+	i.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	next := i.cron.Entry(entryID).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// processScheduledSource reloads a source and processes it if still active
+func (i *Ingester) processScheduledSource(sourceID string) {
+	source, err := i.GetSource(context.Background(), sourceID)
+	if err != nil {
+		log.Printf("Error loading scheduled source %s: %v", sourceID, err)
+		return
+	}
+	if !source.Active {
+		return
+	}
+
+	if _, err := i.runSource(*source, RunTriggerSchedule); err != nil {
+		log.Printf("Skipping scheduled run of source %s: %v", sourceID, err)
+	}
 }
 
-func (i *Ingester) processActiveSources() {
+// processActiveSources queues a run for every active source that isn't
+// already queued or running
+func (i *Ingester) processActiveSources(trigger string) {
 	sources, err := i.getActiveSources()
 	if err != nil {
 		log.Printf("Error getting active sources: %v", err)
 		return
 	}
 
-	var wg sync.WaitGroup
 	for _, source := range sources {
-		wg.Add(1)
-		go func(src Source) {
-			defer wg.Done()
-			if err := i.processSource(src); err != nil {
-				log.Printf("Error processing source %s: %v", src.ID, err)
-			}
-		}(source)
+		if _, err := i.runSource(source, trigger); err != nil && !errors.Is(err, errRunInProgress) {
+			log.Printf("Error queueing run for source %s: %v", source.ID, err)
+		}
 	}
-	wg.Wait()
 }
 
-func (i *Ingester) processSource(source Source) error {
+// processSource fetches a source and indexes its content. Failures of
+// individual items are recorded in the returned stats; an error means the
+// source as a whole could not be processed.
+func (i *Ingester) processSource(ctx context.Context, source Source) (RunStats, error) {
+	var stats RunStats
 	var contents []Content
-	var err error
+	var complete bool
+
+	// The allowed paths may have changed since the source was created
+	if err := checkSourcePath(source, i.cfg.Sources.AllowedPaths); err != nil {
+		return stats, err
+	}
 
+	// Crawls, directories and repositories fetch and index item by item
+	var scan func(context.Context, Source, *RunStats) error
 	switch source.Type {
-	case SourceTypeAPI:
-		contents, err = i.apiProcessor.Fetch(source.URL)
-	case SourceTypeLink:
-		contents, err = i.webProcessor.Fetch(source.URL)
-	case SourceTypePDF:
-		contents, err = i.pdfProcessor.Fetch(source.URL)
-	case SourceTypeYouTube:
-		contents, err = i.ytProcessor.Fetch(source.URL)
-	case SourceTypeRSS:
-		contents, err = i.rssProcessor.Fetch(source.URL)
-	default:
-		return fmt.Errorf("unknown source type: %s", source.Type)
+	case SourceTypeCrawl:
+		scan = i.crawlSource
+	case SourceTypeDirectory:
+		scan = i.scanDirectory
+	case SourceTypeGit:
+		scan = i.syncGitRepository
+	}
+	if scan != nil {
+		if err := scan(ctx, source, &stats); err != nil {
+			return stats, err
+		}
+		if stats.indexed() == 0 && stats.DocumentsFailed > 0 {
+			return stats, nil
+		}
+		if err := i.updateSourceLastUpdated(source.ID); err != nil {
+			return stats, fmt.Errorf("failed to update last processed time: %w", err)
+		}
+		return stats, nil
 	}
 
+	cache, err := i.loadFetchCache(ctx, source.ID)
 	if err != nil {
+		return stats, err
+	}
+
+	// Retry transient fetch failures with backoff, bounding every attempt
+	// by the fetch timeout
+	attempts, err := retry(ctx, i.fetchPolicy(), "fetch of "+source.URL, func(ctx context.Context) error {
+		ctx, cancel := withRequestTimeout(ctx, time.Duration(i.cfg.Sources.TimeoutDuration))
+		defer cancel()
+
+		var err error
+		contents, complete, err = i.fetchSource(ctx, source, cache)
 		return err
+	})
+	stats.Attempts = attempts
+	if errors.Is(err, errNotModified) {
+		// Nothing changed since the last run, so there is nothing to index
+		stats.NotModified = true
+		if err := i.saveFetchCache(ctx, source.ID, cache); err != nil {
+			return stats, err
+		}
+		if err := i.updateSourceLastUpdated(source.ID); err != nil {
+			return stats, fmt.Errorf("failed to update last processed time: %w", err)
+		}
+		return stats, nil
 	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to fetch %s: %w", source.URL, err)
+	}
+	stats.ItemsFetched = len(contents)
 
-	// Process each piece of content
+	// Process each piece of content; documents are keyed by the item so
+	// unchanged items are skipped and changed ones replaced in place
+	docIDs := make([]string, 0, len(contents))
+	indexed := map[string]bool{}
+	failedItems := map[string]bool{}
 	for _, content := range contents {
-		// Generate embedding
-		embedding, err := generateEmbedding(content.Text)
-		if err != nil {
-			log.Printf("Error generating embedding for content from %s: %v", source.URL, err)
+		if content.Err != nil {
+			stats.addFailure(contentLabel(content), content.Err)
+			docIDs = append(docIDs, documentID(source.ID, contentKey(content)))
+			failedItems[feedItemKey(content)] = true
 			continue
 		}
+		failed := stats.DocumentsFailed
+		docIDs = append(docIDs, i.indexContent(ctx, source, content, &stats))
+		if stats.DocumentsFailed == failed {
+			indexed[feedItemKey(content)] = true
+		} else {
+			failedItems[feedItemKey(content)] = true
+		}
+	}
+
+	// Feed items are processed once, when the item and all its enclosures
+	// were indexed; failed items are tried again next run
+	if source.Type == SourceTypeRSS {
+		var seen []string
+		for key := range indexed {
+			if !failedItems[key] {
+				seen = append(seen, key)
+			}
+		}
+		if err := i.markFeedItemsSeen(ctx, source.ID, seen); err != nil {
+			return stats, err
+		}
+	}
 
-		// Add document to database
-		err = db.AddDocument(context.Background(), fmt.Sprintf("%s-%d", source.ID, time.Now().UnixNano()), content.Text, embedding)
+	if stats.indexed() == 0 && stats.DocumentsFailed > 0 {
+		return stats, nil
+	}
 
+	// Vanished items are removed when the fetch listed every item of the
+	// source, unless it returned nothing at all
+	if complete && len(contents) > 0 {
+		removed, err := db.DeleteMissingDocuments(ctx, source.ID, docIDs)
 		if err != nil {
-			log.Printf("Error adding document from %s: %v", source.URL, err)
-			continue
+			return stats, err
+		}
+		stats.DocumentsRemoved = removed
+	}
+
+	// Only remember the validators once everything fetched was indexed, so a
+	// failed item is fetched again on the next run instead of getting a 304
+	if stats.DocumentsFailed == 0 {
+		if err := i.saveFetchCache(ctx, source.ID, cache); err != nil {
+			return stats, err
 		}
 	}
 
 	// Update last processed time
-	return i.updateSourceLastUpdated(source.ID)
+	if err := i.updateSourceLastUpdated(source.ID); err != nil {
+		return stats, fmt.Errorf("failed to update last processed time: %w", err)
+	}
+
+	return stats, nil
+}
+
+// indexContent indexes an item of a source under its stable document ID,
+// recording the outcome in stats, and returns the document ID
+func (i *Ingester) indexContent(ctx context.Context, source Source, content Content, stats *RunStats) string {
+	content.SourceID = source.ID
+	content.SourceType = source.Type
+	docID := documentID(source.ID, contentKey(content))
+
+	outcome, chunks, err := db.IndexContent(ctx, docID, content)
+	if err != nil {
+		log.Printf("Error indexing content from %s: %v", source.URL, err)
+		stats.addFailure(contentLabel(content), err)
+		return docID
+	}
+	stats.addOutcome(outcome, chunks)
+
+	return docID
+}
+
+// fetchPolicy returns the retry policy for fetches
+func (i *Ingester) fetchPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: i.cfg.Sources.MaxRetries,
+		Delay:      time.Duration(i.cfg.Sources.RetryDelay),
+	}
+}
+
+// fetchSource fetches the content of a source with the processor for its
+// type. complete reports whether the contents are every item of the source,
+// so that the documents of items that are no longer listed can be removed.
+func (i *Ingester) fetchSource(ctx context.Context, source Source, cache *FetchCache) (contents []Content, complete bool, err error) {
+	switch source.Type {
+	case SourceTypeAPI:
+		return i.apiProcessor.Fetch(ctx, source.URL, source.Options.api(), cache)
+	case SourceTypeLink:
+		contents, err = i.webProcessor.Fetch(ctx, source.URL, source.Options.extract(), cache)
+	case SourceTypePDF:
+		contents, err = i.pdfProcessor.Fetch(ctx, source.URL, cache)
+	case SourceTypeText:
+		contents, err = i.textProcessor.Fetch(ctx, source.URL, cache)
+	case SourceTypeYouTube:
+		return i.ytProcessor.Fetch(ctx, source.URL, source.Options.youtube())
+	case SourceTypeRSS:
+		// Feeds only list their latest items, so items that dropped off a
+		// feed are kept
+		seen, err := i.seenFeedItems(ctx, source.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		contents, err = i.rssProcessor.Fetch(ctx, source.URL, source.Options.rss(), seen, cache)
+		return contents, false, err
+	default:
+		return nil, false, permanent(fmt.Errorf("unknown source type: %s", source.Type))
+	}
+	return contents, err == nil, err
+}
+
+// contentKey returns the identity of a content item within its source
+func contentKey(content Content) string {
+	if content.ID != "" {
+		return content.ID
+	}
+	return contentLabel(content)
+}
+
+// contentLabel identifies a content item in run failures
+func contentLabel(content Content) string {
+	if content.URL != "" {
+		return content.URL
+	}
+	return content.Title
 }
 
 func (i *Ingester) getActiveSources() ([]Source, error) {
 	var sources []Source
-	query := `SELECT * FROM knowledge_sources WHERE active = true`
+	query := `SELECT ` + sourceColumns + ` FROM knowledge_sources WHERE active = true`
 	err := i.db.Select(&sources, query)
 	return sources, err
 }
@@ -336,14 +938,3 @@ func (i *Ingester) updateSourceLastUpdated(sourceID string) error {
 	_, err := i.db.Exec(query, sourceID)
 	return err
 }
-
-// AddSource adds a new knowledge source
-func (i *Ingester) AddSource(sourceType, url, schedule string) error {
-	query := `
-        INSERT INTO knowledge_sources (id, type, url, schedule)
-        VALUES ($1, $2, $3, $4)`
-
-	sourceID := fmt.Sprintf("%s-%d", sourceType, time.Now().UnixNano())
-	_, err := i.db.Exec(query, sourceID, sourceType, url, schedule)
-	return err
-}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// limitedEmbedder bounds the number of concurrent embedding requests so
+// parallel ingestion runs don't flood the embedding model
+type limitedEmbedder struct {
+	Embedder
+	slots chan struct{}
+}
+
+func newLimitedEmbedder(e Embedder, concurrency int) *limitedEmbedder {
+	return &limitedEmbedder{Embedder: e, slots: make(chan struct{}, concurrency)}
+}
+
+func (e *limitedEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	select {
+	case e.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-e.slots }()
+
+	return e.Embedder.Embed(ctx, text)
+}
+
+// hostLimiter keeps fetches polite: at most maxPerHost concurrent requests
+// to a host, started at least delay apart
+type hostLimiter struct {
+	maxPerHost int
+	delay      time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// hostState tracks the requests to a single host
+type hostState struct {
+	slots chan struct{}
+	next  time.Time
+}
+
+func newHostLimiter(maxPerHost int, delay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		maxPerHost: max(maxPerHost, 1),
+		delay:      delay,
+		hosts:      map[string]*hostState{},
+	}
+}
+
+// acquire waits until a request to the host of rawURL may start and returns
+// the function that releases it. A delay longer than the default, such as a
+// robots.txt crawl-delay, spaces requests further apart.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string, delay time.Duration) (func(), error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	state, ok := l.hosts[host]
+	if !ok {
+		state = &hostState{slots: make(chan struct{}, l.maxPerHost)}
+		l.hosts[host] = state
+	}
+	l.mu.Unlock()
+
+	select {
+	case state.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-state.slots }
+
+	// Reserve the next start time for this host
+	delay = max(delay, l.delay)
+	l.mu.Lock()
+	start := time.Now()
+	if state.next.After(start) {
+		start = state.next
+	}
+	state.next = start.Add(delay)
+	l.mu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency tracks how many calls run at once and the most seen
+type concurrency struct {
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *concurrency) enter() {
+	n := c.current.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+func (c *concurrency) leave() {
+	c.current.Add(-1)
+}
+
+func TestHostLimiterConcurrency(t *testing.T) {
+	tests := []struct {
+		maxPerHost int
+		want       int32
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		limiter := newHostLimiter(tt.maxPerHost, 0)
+		var running concurrency
+		var wg sync.WaitGroup
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := limiter.acquire(context.Background(), "https://example.com/page", 0)
+				if err != nil {
+					t.Errorf("acquire failed: %v", err)
+					return
+				}
+				running.enter()
+				time.Sleep(5 * time.Millisecond)
+				running.leave()
+				release()
+			}()
+		}
+		wg.Wait()
+		if peak := running.peak.Load(); peak != tt.want {
+			t.Errorf("maxPerHost %d: %d concurrent requests, want %d", tt.maxPerHost, peak, tt.want)
+		}
+	}
+}
+
+func TestHostLimiterHostsAreIndependent(t *testing.T) {
+	limiter := newHostLimiter(1, time.Hour)
+	release, err := limiter.acquire(context.Background(), "https://a.example.com/", 0)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer release()
+
+	// Another host neither waits for the slot nor for the delay
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := limiter.acquire(ctx, "https://b.example.com/", 0)
+	if err != nil {
+		t.Fatalf("acquire for another host failed: %v", err)
+	}
+	other()
+
+	// The busy host waits until the context ends
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "https://a.example.com/other", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context deadline", err)
+	}
+}
+
+func TestHostLimiterDelay(t *testing.T) {
+	tests := []struct {
+		delay      time.Duration
+		crawlDelay time.Duration
+		want       time.Duration
+	}{
+		{20 * time.Millisecond, 0, 40 * time.Millisecond},
+		{0, 20 * time.Millisecond, 40 * time.Millisecond},
+		{20 * time.Millisecond, 5 * time.Millisecond, 40 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		limiter := newHostLimiter(3, tt.delay)
+		start := time.Now()
+		for n := 0; n < 3; n++ {
+			release, err := limiter.acquire(context.Background(), "https://example.com/", tt.crawlDelay)
+			if err != nil {
+				t.Fatalf("acquire failed: %v", err)
+			}
+			release()
+		}
+		if elapsed := time.Since(start); elapsed < tt.want {
+			t.Errorf("delay %v, crawl delay %v: three requests took %v, want at least %v", tt.delay, tt.crawlDelay, elapsed, tt.want)
+		}
+	}
+}
+
+// slowEmbedder records how many embeddings run at once
+type slowEmbedder struct {
+	running concurrency
+}
+
+func (e *slowEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.running.enter()
+	defer e.running.leave()
+	time.Sleep(5 * time.Millisecond)
+	return []float64{1}, nil
+}
+
+func TestLimitedEmbedder(t *testing.T) {
+	inner := &slowEmbedder{}
+	embedder := newLimitedEmbedder(inner, 2)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 6; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := embedder.Embed(context.Background(), "text"); err != nil {
+				t.Errorf("Embed failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak := inner.running.peak.Load(); peak != 2 {
+		t.Errorf("%d concurrent embeddings, want 2", peak)
+	}
+
+	// A full limiter gives up when the context ends
+	embedder = newLimitedEmbedder(inner, 1)
+	embedder.slots <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := embedder.Embed(ctx, "text"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
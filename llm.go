@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+// Supported AI providers
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+)
+
+// LLM generates text from a prompt
+type LLM interface {
+	// Generate returns the complete response for a prompt
+	Generate(ctx context.Context, prompt string) (string, error)
+	// GenerateStream calls onToken for every piece of text as it is generated
+	GenerateStream(ctx context.Context, prompt string, onToken func(token string) error) error
+}
+
+// Embedder converts text into embedding vectors
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Global AI provider instances
+var (
+	llm      LLM
+	embedder Embedder
+)
+
+// NewProvider creates the LLM and Embedder selected by the AI configuration.
+// Concurrent embedding requests are limited to MaxConcurrentEmbeddings and,
+// with retries enabled, transient embedding failures are retried.
+func NewProvider(cfg config.AIConfig) (LLM, Embedder, error) {
+	var model LLM
+	var embed Embedder
+
+	switch cfg.Provider {
+	case ProviderOllama:
+		client := NewOllamaClient(cfg)
+		model, embed = client, client
+	case ProviderOpenAI:
+		client := NewOpenAIClient(cfg)
+		model, embed = client, client
+	default:
+		return nil, nil, fmt.Errorf("unknown AI provider: %s", cfg.Provider)
+	}
+
+	if cfg.MaxConcurrentEmbeddings > 0 {
+		embed = newLimitedEmbedder(embed, cfg.MaxConcurrentEmbeddings)
+	}
+	if cfg.EnableRetries {
+		embed = &retryingEmbedder{
+			Embedder: embed,
+			policy:   RetryPolicy{MaxRetries: cfg.MaxRetries, Delay: time.Duration(cfg.RetryDelay)},
+		}
+	}
+
+	return model, embed, nil
+}
+
+// retryingEmbedder retries transient embedding failures with backoff
+type retryingEmbedder struct {
+	Embedder
+	policy RetryPolicy
+}
+
+func (e *retryingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	var embedding []float64
+	_, err := retry(ctx, e.policy, "embedding request", func(ctx context.Context) error {
+		var err error
+		embedding, err = e.Embedder.Embed(ctx, text)
+		return err
+	})
+	return embedding, err
+}
+
+// checkEmbeddingDimension embeds a probe text and verifies that the model
+// returns vectors of the expected dimension
+func checkEmbeddingDimension(ctx context.Context, e Embedder, expected int) error {
+	embedding, err := e.Embed(ctx, "dimension probe")
+	if err != nil {
+		return fmt.Errorf("failed to probe embedding model: %w", err)
+	}
+
+	if len(embedding) != expected {
+		return fmt.Errorf("embedding model returned %d dimensions but embeddingDim is %d", len(embedding), expected)
+	}
+
+	return nil
+}
+
+// postJSON sends body as JSON to url and returns the response if the
+// status code is 200 OK. The Authorization header is only sent when apiKey is
+// set, so keyless servers work. The caller must close the response body.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %w", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newStatusError(resp)
+	}
+
+	return resp, nil
+}
+
+// withRequestTimeout bounds a non-streaming request by the configured timeout
+func withRequestTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,14 +17,62 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	llm, embedder, err = NewProvider(cfg.AI)
+	if err != nil {
+		log.Fatalf("Failed to initialize AI provider: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.AI.RequestTimeout))
+	err = checkEmbeddingDimension(ctx, embedder, cfg.AI.EmbeddingDim)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to verify embedding model %s: %v", cfg.AI.EmbeddingModel, err)
+	}
+
+	reranker, err = NewReranker(cfg.Retrieval.Rerank, llm)
+	if err != nil {
+		log.Fatalf("Failed to initialize reranker: %v", err)
+	}
+
+	chunker, err = NewChunker(cfg.Chunking)
+	if err != nil {
+		log.Fatalf("Failed to initialize chunker: %v", err)
+	}
+
 	db, err = InitPostgres(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Sdb.Close()
+
+	ingester, err = NewIngester(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize ingester: %v", err)
+	}
+	if err := ingester.Start(); err != nil {
+		log.Fatalf("Failed to start ingester: %v", err)
+	}
+	defer ingester.Stop()
+
 	fs := http.FileServer(http.Dir("frontend"))
 	http.Handle("/", fs)
 	http.HandleFunc("/chat", chatHandler)
+	http.HandleFunc("GET /api/conversations", listConversationsHandler)
+	http.HandleFunc("GET /api/conversations/{id}", getConversationHandler)
+	http.HandleFunc("PATCH /api/conversations/{id}", renameConversationHandler)
+	http.HandleFunc("DELETE /api/conversations/{id}", deleteConversationHandler)
+	http.HandleFunc("POST /api/sources", createSourceHandler)
+	http.HandleFunc("GET /api/sources", listSourcesHandler)
+	http.HandleFunc("GET /api/sources/{id}", getSourceHandler)
+	http.HandleFunc("PATCH /api/sources/{id}", updateSourceHandler)
+	http.HandleFunc("DELETE /api/sources/{id}", deleteSourceHandler)
+	http.HandleFunc("POST /api/sources/{id}/refresh", refreshSourceHandler)
+	http.HandleFunc("POST /api/sources/refresh", refreshAllSourcesHandler)
+	http.HandleFunc("GET /api/sources/{id}/runs", listSourceRunsHandler)
+	http.HandleFunc("GET /api/runs", listRunsHandler)
+	http.HandleFunc("GET /api/runs/{id}", getRunHandler)
+	http.HandleFunc("POST /api/documents", uploadDocumentsHandler)
+	http.HandleFunc("POST /api/documents/text", createTextDocumentHandler)
 
 	server := &http.Server{
 		Addr:           ":8080",
@@ -1,10 +1,14 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
 )
 
 type OllamaRequest struct {
@@ -28,36 +32,59 @@ type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
-const (
-	ollamaBaseURL = "http://localhost:11434/api"
-	modelName     = "llama2"
-)
+// OllamaClient talks to an Ollama server's native API
+type OllamaClient struct {
+	baseURL        string
+	model          string
+	embeddingModel string
+	temperature    float64
+	maxTokens      int
+	timeout        time.Duration
+	client         *http.Client
+}
 
-// Generate text using Ollama
-func generateText(prompt string) (string, error) {
-	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: prompt,
-		Stream: false,
+// NewOllamaClient creates an Ollama client from the AI configuration
+func NewOllamaClient(cfg config.AIConfig) *OllamaClient {
+	return &OllamaClient{
+		baseURL:        cfg.BaseURL,
+		model:          cfg.Model,
+		embeddingModel: cfg.EmbeddingModel,
+		temperature:    cfg.Temperature,
+		maxTokens:      cfg.MaxTokens,
+		timeout:        time.Duration(cfg.RequestTimeout),
+		client:         &http.Client{},
 	}
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %w", err)
+// options returns the generation options sent with every request
+func (c *OllamaClient) options() map[string]interface{} {
+	options := map[string]interface{}{
+		"temperature": c.temperature,
+	}
+	if c.maxTokens > 0 {
+		options["num_predict"] = c.maxTokens
 	}
+	return options
+}
+
+// Generate text using Ollama
+func (c *OllamaClient) Generate(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := withRequestTimeout(ctx, c.timeout)
+	defer cancel()
 
-	resp, err := http.Post(fmt.Sprintf("%s/generate", ollamaBaseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData))
+	reqBody := OllamaRequest{
+		Model:   c.model,
+		Prompt:  prompt,
+		Stream:  false,
+		Options: c.options(),
+	}
+
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/generate", c.baseURL), "", reqBody)
 	if err != nil {
 		return "", fmt.Errorf("error calling Ollama API: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var result OllamaResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("error decoding response: %w", err)
@@ -66,30 +93,61 @@ func generateText(prompt string) (string, error) {
 	return result.Response, nil
 }
 
-// Generate embeddings using Ollama
-func generateEmbedding(text string) ([]float64, error) {
-	reqBody := EmbeddingRequest{
-		Model:  modelName,
-		Prompt: text,
+// GenerateStream generates text using Ollama's streaming API, calling
+// onToken for every NDJSON chunk until the final chunk with Done set.
+func (c *OllamaClient) GenerateStream(ctx context.Context, prompt string, onToken func(string) error) error {
+	reqBody := OllamaRequest{
+		Model:   c.model,
+		Prompt:  prompt,
+		Stream:  true,
+		Options: c.options(),
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/generate", c.baseURL), "", reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+		return fmt.Errorf("error calling Ollama API: %w", err)
 	}
+	defer resp.Body.Close()
+
+	// Ollama streams one JSON object per line
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk OllamaResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("stream ended before completion")
+			}
+			return fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+
+		if chunk.Response != "" {
+			if err := onToken(chunk.Response); err != nil {
+				return err
+			}
+		}
+
+		if chunk.Done {
+			return nil
+		}
+	}
+}
 
-	resp, err := http.Post(fmt.Sprintf("%s/embeddings", ollamaBaseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData))
+// Embed generates embeddings using Ollama
+func (c *OllamaClient) Embed(ctx context.Context, text string) ([]float64, error) {
+	ctx, cancel := withRequestTimeout(ctx, c.timeout)
+	defer cancel()
+
+	reqBody := EmbeddingRequest{
+		Model:  c.embeddingModel,
+		Prompt: text,
+	}
+
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/embeddings", c.baseURL), "", reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("error calling Ollama API: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var result EmbeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("error decoding response: %w", err)
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+type OpenAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIChatRequest struct {
+	Model       string              `json:"model"`
+	Messages    []OpenAIChatMessage `json:"messages"`
+	Temperature float64             `json:"temperature"`
+	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Stream      bool                `json:"stream"`
+}
+
+type OpenAIChatResponse struct {
+	Choices []struct {
+		Message OpenAIChatMessage `json:"message"`
+		Delta   OpenAIChatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+type OpenAIEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// OpenAIClient talks to any server implementing the OpenAI chat completions
+// and embeddings API, such as llama.cpp server, vLLM or an API gateway
+type OpenAIClient struct {
+	baseURL        string
+	apiKey         string
+	model          string
+	embeddingModel string
+	temperature    float64
+	maxTokens      int
+	timeout        time.Duration
+	client         *http.Client
+}
+
+// NewOpenAIClient creates an OpenAI-compatible client from the AI configuration
+func NewOpenAIClient(cfg config.AIConfig) *OpenAIClient {
+	return &OpenAIClient{
+		baseURL:        cfg.BaseURL,
+		apiKey:         cfg.APIKey,
+		model:          cfg.Model,
+		embeddingModel: cfg.EmbeddingModel,
+		temperature:    cfg.Temperature,
+		maxTokens:      cfg.MaxTokens,
+		timeout:        time.Duration(cfg.RequestTimeout),
+		client:         &http.Client{},
+	}
+}
+
+// chatRequest builds a single-turn chat completion request
+func (c *OpenAIClient) chatRequest(prompt string, stream bool) OpenAIChatRequest {
+	return OpenAIChatRequest{
+		Model:       c.model,
+		Messages:    []OpenAIChatMessage{{Role: "user", Content: prompt}},
+		Temperature: c.temperature,
+		MaxTokens:   c.maxTokens,
+		Stream:      stream,
+	}
+}
+
+// Generate text using the chat completions endpoint
+func (c *OpenAIClient) Generate(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := withRequestTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/chat/completions", c.baseURL), c.apiKey, c.chatRequest(prompt, false))
+	if err != nil {
+		return "", fmt.Errorf("error calling OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result OpenAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("response contained no choices")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+// GenerateStream generates text using the chat completions endpoint in
+// streaming mode, which delivers deltas as Server-Sent Events
+func (c *OpenAIClient) GenerateStream(ctx context.Context, prompt string, onToken func(string) error) error {
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/chat/completions", c.baseURL), c.apiKey, c.chatRequest(prompt, true))
+	if err != nil {
+		return fmt.Errorf("error calling OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk OpenAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		if err := onToken(chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading stream: %w", err)
+	}
+
+	return fmt.Errorf("stream ended before completion")
+}
+
+// Embed generates embeddings using the embeddings endpoint
+func (c *OpenAIClient) Embed(ctx context.Context, text string) ([]float64, error) {
+	ctx, cancel := withRequestTimeout(ctx, c.timeout)
+	defer cancel()
+
+	reqBody := OpenAIEmbeddingRequest{
+		Model: c.embeddingModel,
+		Input: text,
+	}
+
+	resp, err := postJSON(ctx, c.client, fmt.Sprintf("%s/embeddings", c.baseURL), c.apiKey, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error calling OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("response contained no embeddings")
+	}
+
+	return result.Data[0].Embedding, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxPDFSize bounds the size of downloaded PDFs
+const maxPDFSize = 50 << 20
+
+var (
+	// errPDFEncrypted is returned for PDFs that cannot be opened without a
+	// password
+	errPDFEncrypted = errors.New("PDF is encrypted")
+	// errPDFNoText is returned for PDFs without a text layer, such as
+	// scanned documents
+	errPDFNoText = errors.New("PDF has no extractable text, it may contain only images")
+)
+
+// openError explains why a PDF could not be opened. Neither cause goes away
+// on retry.
+func openError(err error) error {
+	if errors.Is(err, pdf.ErrInvalidPassword) || strings.Contains(err.Error(), "encryption") {
+		return permanent(fmt.Errorf("%w: %v", errPDFEncrypted, err))
+	}
+	return permanent(fmt.Errorf("failed to open PDF: %w", err))
+}
+
+// pdfData reads a PDF held in memory
+func pdfData(data []byte, name string) (Content, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Content{}, openError(err)
+	}
+	return readPDF(r, name)
+}
+
+// readPDF reads the text of every page of a PDF, marking where each page
+// starts so chunks can cite "p. N". name is the path or URL of the PDF;
+// page locations of URLs link to the page.
+func readPDF(r *pdf.Reader, name string) (Content, error) {
+	content := Content{
+		Title:       pdfTitle(name),
+		Source:      name,
+		URL:         name,
+		PublishedAt: time.Now(),
+		Metadata:    Metadata{"pages": r.NumPage()},
+	}
+
+	info := r.Trailer().Key("Info")
+	if title := strings.TrimSpace(info.Key("Title").Text()); title != "" {
+		content.Title = title
+	}
+	if author := strings.TrimSpace(info.Key("Author").Text()); author != "" {
+		content.Metadata["author"] = author
+	}
+	if created, ok := pdfDate(info.Key("CreationDate").Text()); ok {
+		content.PublishedAt = created
+	}
+
+	var text strings.Builder
+	length := 0
+	for pageIndex := 1; pageIndex <= r.NumPage(); pageIndex++ {
+		page := r.Page(pageIndex)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := page.GetPlainText(nil)
+		if err != nil {
+			continue
+		}
+		pageText = strings.TrimSpace(pageText)
+		if pageText == "" {
+			continue
+		}
+
+		if length > 0 {
+			text.WriteString("\n\n")
+			length += 2
+		}
+		location := Location{Offset: length, Label: fmt.Sprintf("p. %d", pageIndex)}
+		if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+			location.URL = fmt.Sprintf("%s#page=%d", name, pageIndex)
+		}
+		content.Locations = append(content.Locations, location)
+
+		text.WriteString(pageText)
+		length += utf8.RuneCountInString(pageText)
+	}
+
+	if length == 0 {
+		return Content{}, permanent(errPDFNoText)
+	}
+	content.Text = text.String()
+	return content, nil
+}
+
+// pdfTitle names a PDF after its file until its Info title is known
+func pdfTitle(name string) string {
+	base := path.Base(strings.SplitN(name, "?", 2)[0])
+	if base == "." || base == "/" {
+		return name
+	}
+	return base
+}
+
+// pdfDate parses PDF dates such as "D:20230115093000+01'00'"
+func pdfDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	s = strings.ReplaceAll(s, "'", "")
+	for _, layout := range []string{"20060102150405Z0700", "20060102150405Z", "20060102150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildPDF writes a minimal PDF with one line of text per page and an Info
+// dictionary
+func buildPDF(info string, pages ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		info,
+	}
+	var kids []string
+	for _, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", len(objects)))
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(b.String())
+}
+
+func TestPDFData(t *testing.T) {
+	data := buildPDF("<< /Title (Handbook) /Author (Support team) /CreationDate (D:20230115093000+01'00') >>",
+		"First page text", "Second page text")
+
+	content, err := pdfData(data, "https://example.com/files/handbook.pdf")
+	if err != nil {
+		t.Fatalf("pdfData failed: %v", err)
+	}
+	if content.Title != "Handbook" || content.Metadata["author"] != "Support team" || content.Metadata["pages"] != 2 {
+		t.Errorf("title = %q, metadata = %v", content.Title, content.Metadata)
+	}
+	if !content.PublishedAt.Equal(time.Date(2023, 1, 15, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("published at = %v, want the creation date", content.PublishedAt)
+	}
+
+	if len(content.Locations) != 2 {
+		t.Fatalf("got %d page locations, want 2", len(content.Locations))
+	}
+	for i, location := range content.Locations {
+		page := i + 1
+		if location.Label != fmt.Sprintf("p. %d", page) || location.URL != fmt.Sprintf("https://example.com/files/handbook.pdf#page=%d", page) {
+			t.Errorf("location %d = %+v", page, location)
+		}
+		if want := []string{"First", "Second"}[i]; !strings.HasPrefix(content.Text[location.Offset:], want) {
+			t.Errorf("page %d starts at %q, want %q", page, content.Text[location.Offset:], want)
+		}
+	}
+}
+
+func TestPDFDataWithoutText(t *testing.T) {
+	_, err := pdfData(buildPDF("<< >>", ""), "/srv/docs/scan.pdf")
+	if !errors.Is(err, errPDFNoText) || isTransient(err) {
+		t.Errorf("err = %v, want a permanent no text error", err)
+	}
+
+	if _, err := pdfData([]byte("not a PDF"), "broken.pdf"); err == nil || isTransient(err) {
+		t.Errorf("err = %v, want a permanent open error", err)
+	}
+}
+
+func TestPDFDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"D:20230115093000+01'00'", time.Date(2023, 1, 15, 8, 30, 0, 0, time.UTC)},
+		{"D:20230115093000Z", time.Date(2023, 1, 15, 9, 30, 0, 0, time.UTC)},
+		{"D:20230115093000", time.Date(2023, 1, 15, 9, 30, 0, 0, time.UTC)},
+		{" 20230115 ", time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := pdfDate(tt.value)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("pdfDate(%q) = %v, %v; want %v", tt.value, got, ok, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "D:2023"} {
+		if _, ok := pdfDate(value); ok {
+			t.Errorf("pdfDate(%q) should fail", value)
+		}
+	}
+}
+
+func TestPDFTitle(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/files/handbook.pdf?download=1": "handbook.pdf",
+		"/srv/docs/guide.pdf":                               "guide.pdf",
+		"/":                                                 "/",
+	}
+	for name, want := range tests {
+		if got := pdfTitle(name); got != want {
+			t.Errorf("pdfTitle(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
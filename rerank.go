@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+// Reranking methods
+const (
+	RerankMethodLLM     = "llm"
+	RerankMethodLexical = "lexical"
+)
+
+// llmRerankConcurrency bounds how many relevance prompts run at once
+const llmRerankConcurrency = 4
+
+// Global reranker, nil when reranking is disabled
+var reranker Reranker
+
+// Reranker rescores retrieved documents against the query. It returns the
+// documents with Score set to the new relevance, best first.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, docs []Document) ([]Document, error)
+}
+
+// NewReranker creates the reranker selected by the rerank configuration
+func NewReranker(cfg config.RerankConfig, model LLM) (Reranker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	switch cfg.Method {
+	case RerankMethodLLM:
+		return &LLMReranker{llm: model}, nil
+	case RerankMethodLexical:
+		return &LexicalReranker{}, nil
+	default:
+		return nil, fmt.Errorf("unknown rerank method: %s", cfg.Method)
+	}
+}
+
+// LLMReranker asks the language model to grade each passage's relevance to
+// the question, in the manner of a cross-encoder
+type LLMReranker struct {
+	llm LLM
+}
+
+var relevanceScorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// Rerank scores every document with the model. Documents that fail to score
+// keep their retrieval order below the scored ones; if none can be scored,
+// such as during an LLM outage, an error is returned instead.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []Document) ([]Document, error) {
+	reranked := make([]Document, len(docs))
+	copy(reranked, docs)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	failed := 0
+	sem := make(chan struct{}, llmRerankConcurrency)
+	for i := range reranked {
+		wg.Add(1)
+		go func(doc *Document) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			score, err := r.score(ctx, query, doc.Content)
+			if err != nil {
+				log.Printf("Error scoring %s for reranking: %v", doc.DocID, err)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed++
+				mu.Unlock()
+			}
+			doc.Score = score
+		}(&reranked[i])
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(reranked) > 0 && failed == len(reranked) {
+		return nil, fmt.Errorf("failed to score any of %d documents: %w", len(reranked), firstErr)
+	}
+
+	sortByScore(reranked)
+	return reranked, nil
+}
+
+// score returns the model's 0-10 relevance grade scaled to 0-1
+func (r *LLMReranker) score(ctx context.Context, query, passage string) (float64, error) {
+	prompt := fmt.Sprintf(`Rate how relevant the passage is for answering the question, on a scale from 0 (irrelevant) to 10 (answers it directly). Reply with the number only.
+
+Question: %s
+
+Passage:
+%s
+
+Score:`, query, passage)
+
+	response, err := r.llm.Generate(ctx, prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	match := relevanceScorePattern.FindString(response)
+	if match == "" {
+		return 0, fmt.Errorf("no score in response %q", response)
+	}
+
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Min(score, 10) / 10, nil
+}
+
+// LexicalReranker scores documents locally with BM25 over the candidate set,
+// which favours passages that contain the query's rarer terms
+type LexicalReranker struct{}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+func (r *LexicalReranker) Rerank(ctx context.Context, query string, docs []Document) ([]Document, error) {
+	reranked := make([]Document, len(docs))
+	copy(reranked, docs)
+	if len(reranked) == 0 {
+		return reranked, nil
+	}
+
+	terms := tokenize(query)
+	docTerms := make([]map[string]int, len(reranked))
+	docFreq := map[string]int{}
+	totalLen := 0
+	for i, doc := range reranked {
+		counts := map[string]int{}
+		tokens := tokenize(doc.Content)
+		for _, token := range tokens {
+			counts[token]++
+		}
+		for term := range counts {
+			docFreq[term]++
+		}
+		docTerms[i] = counts
+		totalLen += len(tokens)
+	}
+
+	n := float64(len(reranked))
+	avgLen := math.Max(float64(totalLen)/n, 1)
+	maxScore := 0.0
+	for i := range reranked {
+		docLen := 0
+		for _, c := range docTerms[i] {
+			docLen += c
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			tf := float64(docTerms[i][term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(docLen)/avgLen))
+		}
+		reranked[i].Score = score
+		maxScore = math.Max(maxScore, score)
+	}
+
+	// Scale to 0-1 so scores are comparable with the LLM reranker
+	if maxScore > 0 {
+		for i := range reranked {
+			reranked[i].Score /= maxScore
+		}
+	}
+
+	sortByScore(reranked)
+	return reranked, nil
+}
+
+// tokenize lowercases text and splits it into words, keeping identifier
+// characters such as '_' and '-' so error codes stay intact
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+	})
+}
+
+// sortByScore orders documents by descending score
+func sortByScore(docs []Document) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+}
+
+// selectDiverse picks up to n documents using maximal marginal relevance:
+// each step takes the document maximising lambda*relevance minus
+// (1-lambda)*similarity to the documents already picked. Documents whose
+// embedding is at least duplicateThreshold similar to a picked one are
+// dropped as near-duplicates. Relevance is taken from Score.
+func selectDiverse(docs []Document, n int, lambda, duplicateThreshold float64) []Document {
+	remaining := make([]Document, len(docs))
+	copy(remaining, docs)
+
+	var selected []Document
+	for len(selected) < n && len(remaining) > 0 {
+		best := -1
+		bestValue := math.Inf(-1)
+		for i := 0; i < len(remaining); i++ {
+			redundancy := 0.0
+			for _, s := range selected {
+				redundancy = math.Max(redundancy, cosineSimilarity(remaining[i].Embedding, s.Embedding))
+			}
+
+			if len(selected) > 0 && redundancy >= duplicateThreshold {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				i--
+				continue
+			}
+
+			value := lambda*remaining[i].Score - (1-lambda)*redundancy
+			if value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		selected = append(selected, remaining[best])
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+
+	return selected
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, or 0 if
+// either is empty or they differ in length
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
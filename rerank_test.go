@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedLLM answers each relevance prompt by looking up the passage
+type scriptedLLM struct {
+	scores map[string]string
+	err    error
+}
+
+func (m *scriptedLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	for passage, score := range m.scores {
+		if strings.Contains(prompt, "Passage:\n"+passage+"\n") {
+			return score, nil
+		}
+	}
+	return "", m.err
+}
+
+func (m *scriptedLLM) GenerateStream(ctx context.Context, prompt string, onToken func(token string) error) error {
+	return errors.New("not implemented")
+}
+
+func TestLLMRerankerOrdersByScore(t *testing.T) {
+	r := &LLMReranker{llm: &scriptedLLM{scores: map[string]string{
+		"alpha": "3",
+		"beta":  "Score: 9",
+		"gamma": "12",
+	}}}
+	docs := []Document{{DocID: "a", Content: "alpha"}, {DocID: "b", Content: "beta"}, {DocID: "c", Content: "gamma"}}
+
+	reranked, err := r.Rerank(context.Background(), "q", docs)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if got := strings.Join(docIDs(reranked), ","); got != "c,b,a" {
+		t.Errorf("order = %s, want c,b,a", got)
+	}
+	if reranked[0].Score != 1 {
+		t.Errorf("score above 10 = %v, want capped at 1", reranked[0].Score)
+	}
+}
+
+func TestLLMRerankerKeepsRetrievalOrderOfUnscoredDocuments(t *testing.T) {
+	r := &LLMReranker{llm: &scriptedLLM{
+		scores: map[string]string{"gamma": "5"},
+		err:    errors.New("timeout"),
+	}}
+	docs := []Document{{DocID: "a", Content: "alpha"}, {DocID: "b", Content: "beta"}, {DocID: "c", Content: "gamma"}}
+
+	reranked, err := r.Rerank(context.Background(), "q", docs)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if got := strings.Join(docIDs(reranked), ","); got != "c,a,b" {
+		t.Errorf("order = %s, want c,a,b", got)
+	}
+}
+
+func TestLLMRerankerFailsWhenNothingScores(t *testing.T) {
+	outage := errors.New("connection refused")
+	r := &LLMReranker{llm: &scriptedLLM{err: outage}}
+	docs := []Document{{DocID: "a", Content: "alpha"}, {DocID: "b", Content: "beta"}}
+
+	if _, err := r.Rerank(context.Background(), "q", docs); !errors.Is(err, outage) {
+		t.Errorf("err = %v, want %v", err, outage)
+	}
+}
+
+func TestLexicalRerankerPrefersRareTerms(t *testing.T) {
+	docs := []Document{
+		{DocID: "common", Content: "the service returned an error"},
+		{DocID: "rare", Content: "the service returned error E_QUOTA_42"},
+		{DocID: "none", Content: "unrelated text"},
+	}
+
+	reranked, err := (&LexicalReranker{}).Rerank(context.Background(), "error e_quota_42", docs)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if reranked[0].DocID != "rare" || reranked[0].Score != 1 {
+		t.Errorf("top = %s (%v), want rare with score 1", reranked[0].DocID, reranked[0].Score)
+	}
+	if reranked[2].DocID != "none" || reranked[2].Score != 0 {
+		t.Errorf("last = %s (%v), want none with score 0", reranked[2].DocID, reranked[2].Score)
+	}
+}
+
+func TestSelectDiverse(t *testing.T) {
+	docs := []Document{
+		{DocID: "a", Score: 0.9, Embedding: Vector{1, 0}},
+		{DocID: "a-copy", Score: 0.89, Embedding: Vector{1, 0.01}},
+		{DocID: "b", Score: 0.5, Embedding: Vector{0, 1}},
+		{DocID: "c", Score: 0.4, Embedding: Vector{0.7, 0.7}},
+	}
+
+	tests := []struct {
+		name      string
+		n         int
+		lambda    float64
+		threshold float64
+		want      string
+	}{
+		{"drops near duplicates", 3, 0.5, 0.95, "a,b,c"},
+		{"relevance only keeps duplicates", 2, 1, 1.1, "a,a-copy"},
+		{"diversity first", 2, 0.3, 1.1, "a,b"},
+		{"limits to n", 1, 0.5, 0.95, "a"},
+		{"fewer documents than n", 10, 0.5, 0.95, "a,b,c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(docIDs(selectDiverse(docs, tt.n, tt.lambda, tt.threshold)), ",")
+			if got != tt.want {
+				t.Errorf("selectDiverse = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	if got := cosineSimilarity([]float64{1, 0}, []float64{2, 0}); got != 1 {
+		t.Errorf("parallel = %v, want 1", got)
+	}
+	if got := cosineSimilarity([]float64{1, 0}, []float64{0, 1}); got != 0 {
+		t.Errorf("orthogonal = %v, want 0", got)
+	}
+	if got := cosineSimilarity([]float64{1}, []float64{1, 0}); got != 0 {
+		t.Errorf("length mismatch = %v, want 0", got)
+	}
+}
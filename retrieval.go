@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Search modes
+const (
+	SearchModeVector  = "vector"
+	SearchModeKeyword = "keyword"
+	SearchModeHybrid  = "hybrid"
+)
+
+var errUnknownSearchMode = errors.New("unknown search mode")
+
+// validSearchMode reports whether mode is empty (use the default) or a known search mode
+func validSearchMode(mode string) bool {
+	switch mode {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+		return true
+	}
+	return false
+}
+
+// rankedList is a retrieval result list and the weight it has in fusion
+type rankedList struct {
+	docs   []Document
+	weight float64
+}
+
+// retrieveDocuments finds the documents most relevant to the query using
+// the given search mode, falling back to the configured default mode. When
+// reranking is enabled, candidates are over-fetched, rescored and
+// diversified before the best ones are returned.
+func retrieveDocuments(ctx context.Context, query, mode string, filter *DocumentFilter) ([]Document, error) {
+	cfg := db.cfg.Retrieval
+	if mode == "" {
+		mode = cfg.Mode
+	}
+
+	if reranker == nil {
+		return searchDocuments(ctx, query, mode, cfg.TopK, filter)
+	}
+
+	candidates, err := searchDocuments(ctx, query, mode, cfg.Rerank.Candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	reranked, err := reranker.Rerank(ctx, query, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank documents: %w", err)
+	}
+
+	return selectDiverse(reranked, cfg.Rerank.TopN, cfg.Rerank.MMRLambda, cfg.Rerank.DuplicateThreshold), nil
+}
+
+// searchDocuments returns up to limit documents for the query using a
+// single search mode, with Score set to that mode's relevance measure
+func searchDocuments(ctx context.Context, query, mode string, limit int, filter *DocumentFilter) ([]Document, error) {
+	cfg := db.cfg.Retrieval
+
+	switch mode {
+	case SearchModeVector:
+		docs, err := vectorSearch(ctx, query, limit, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range docs {
+			docs[i].Score = docs[i].Similarity
+		}
+		return docs, nil
+
+	case SearchModeKeyword:
+		docs, err := QueryKeywordDocuments(ctx, query, limit, filter, db)
+		if err != nil {
+			return nil, err
+		}
+		for i := range docs {
+			docs[i].Score = docs[i].KeywordRank
+		}
+		return docs, nil
+
+	case SearchModeHybrid:
+		// Over-fetch from both signals so fusion has candidates to reorder
+		candidates := limit * 2
+
+		vectorDocs, err := vectorSearch(ctx, query, candidates, filter)
+		if err != nil {
+			return nil, err
+		}
+		keywordDocs, err := QueryKeywordDocuments(ctx, query, candidates, filter, db)
+		if err != nil {
+			return nil, err
+		}
+
+		fused := fuseRankings(cfg.RRFK,
+			rankedList{docs: vectorDocs, weight: cfg.VectorWeight},
+			rankedList{docs: keywordDocs, weight: cfg.KeywordWeight},
+		)
+		if len(fused) > limit {
+			fused = fused[:limit]
+		}
+		return fused, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownSearchMode, mode)
+	}
+}
+
+// vectorSearch embeds the query and returns the nearest documents
+func vectorSearch(ctx context.Context, query string, topK int, filter *DocumentFilter) ([]Document, error) {
+	queryEmbedding, err := embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	return QuerySimilarDocuments(ctx, queryEmbedding, topK, db.cfg.Retrieval.SimilarityThreshold, filter, db)
+}
+
+// fuseRankings merges ranked lists with weighted reciprocal rank fusion:
+// each document scores the sum of weight / (k + rank) over the lists it
+// appears in. The result is ordered by descending fused score.
+func fuseRankings(k int, lists ...rankedList) []Document {
+	byID := map[string]*Document{}
+	var order []string
+
+	for _, list := range lists {
+		for rank, doc := range list.docs {
+			fused, ok := byID[doc.DocID]
+			if !ok {
+				d := doc
+				d.Score = 0
+				fused = &d
+				byID[doc.DocID] = fused
+				order = append(order, doc.DocID)
+			}
+
+			// Keep the per-signal scores from whichever list reported them
+			if doc.Similarity != 0 {
+				fused.Similarity = doc.Similarity
+			}
+			if doc.KeywordRank != 0 {
+				fused.KeywordRank = doc.KeywordRank
+			}
+			fused.Score += list.weight / float64(k+rank+1)
+		}
+	}
+
+	docs := make([]Document, 0, len(order))
+	for _, id := range order {
+		docs = append(docs, *byID[id])
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+
+	return docs
+}
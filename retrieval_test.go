@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFuseRankings(t *testing.T) {
+	vector := rankedList{weight: 1, docs: []Document{
+		{DocID: "a", Similarity: 0.9},
+		{DocID: "b", Similarity: 0.8},
+		{DocID: "c", Similarity: 0.7},
+	}}
+	keyword := rankedList{weight: 1, docs: []Document{
+		{DocID: "c", KeywordRank: 0.5},
+		{DocID: "d", KeywordRank: 0.4},
+		{DocID: "b", KeywordRank: 0.3},
+	}}
+
+	docs := fuseRankings(60, vector, keyword)
+	if got := strings.Join(docIDs(docs), ","); got != "c,b,a,d" {
+		t.Fatalf("order = %s, want c,b,a,d", got)
+	}
+
+	want := 1.0/61 + 1.0/63
+	if math.Abs(docs[0].Score-want) > 1e-12 {
+		t.Errorf("fused score of c = %v, want %v", docs[0].Score, want)
+	}
+	if docs[0].Similarity != 0.7 || docs[0].KeywordRank != 0.5 {
+		t.Errorf("c kept similarity %v and keyword rank %v, want both signals", docs[0].Similarity, docs[0].KeywordRank)
+	}
+}
+
+func TestFuseRankingsWeights(t *testing.T) {
+	vector := rankedList{weight: 3, docs: []Document{{DocID: "a"}, {DocID: "b"}}}
+	keyword := rankedList{weight: 1, docs: []Document{{DocID: "b"}, {DocID: "a"}}}
+
+	if got := strings.Join(docIDs(fuseRankings(60, vector, keyword)), ","); got != "a,b" {
+		t.Errorf("order = %s, want the heavier list to win: a,b", got)
+	}
+}
+
+func TestFuseRankingsTiesKeepFirstSeenOrder(t *testing.T) {
+	first := rankedList{weight: 1, docs: []Document{{DocID: "x"}}}
+	second := rankedList{weight: 1, docs: []Document{{DocID: "y"}}}
+
+	if got := strings.Join(docIDs(fuseRankings(60, first, second)), ","); got != "x,y" {
+		t.Errorf("order = %s, want x,y", got)
+	}
+	if docs := fuseRankings(60); len(docs) != 0 {
+		t.Errorf("fusing no lists returned %d documents", len(docs))
+	}
+}
+
+func docIDs(docs []Document) []string {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.DocID
+	}
+	return ids
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"google.golang.org/api/googleapi"
+)
+
+// maxRetryDelay caps the backoff between two attempts
+const maxRetryDelay = 2 * time.Minute
+
+// RetryPolicy controls how often and how patiently an operation is retried
+type RetryPolicy struct {
+	MaxRetries int
+	Delay      time.Duration
+}
+
+// StatusError is returned when a server answers with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Body)
+}
+
+// newStatusError reads the start of an error response into a StatusError
+func newStatusError(resp *http.Response) *StatusError {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(bytes.TrimSpace(msg)),
+		RetryAfter: retryAfter,
+	}
+}
+
+// checkStatus returns a StatusError for non-2xx responses
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newStatusError(resp)
+	}
+	return nil
+}
+
+// permanentError marks an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isTransient reports whether an error is likely to go away on retry:
+// timeouts, temporary network failures, rate limiting and server errors.
+// Anything else, such as a 404, an unknown host or a malformed response, is
+// permanent.
+func isTransient(err error) bool {
+	var permErr *permanentError
+	if errors.As(err, &permErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return transientStatus(statusErr.StatusCode)
+	}
+	var feedErr gofeed.HTTPError
+	if errors.As(err, &feedErr) {
+		return transientStatus(feedErr.StatusCode)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return transientStatus(apiErr.Code)
+	}
+
+	// Other network errors only when they are timeouts or temporary; an
+	// unknown host or a refused connection will fail again
+	var netErr net.Error
+	var tempErr interface{ Temporary() bool }
+	return errors.As(err, &netErr) && (netErr.Timeout() || errors.As(err, &tempErr) && tempErr.Temporary())
+}
+
+// transientStatus reports whether an HTTP status code is worth retrying
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return code >= 500
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based):
+// a random duration between half and all of Delay * 2^(attempt-1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for n := 1; n < attempt && delay < maxRetryDelay; n++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// retry calls op until it succeeds, fails permanently, runs out of retries
+// or ctx is done. It returns the number of attempts made.
+func retry(ctx context.Context, policy RetryPolicy, name string, op func(ctx context.Context) error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt > policy.MaxRetries || !isTransient(err) {
+			return attempt, err
+		}
+
+		delay := policy.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = min(statusErr.RetryAfter, maxRetryDelay)
+		}
+		log.Printf("Retrying %s in %v after attempt %d failed: %v", name, delay, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
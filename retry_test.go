@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", fmt.Errorf("failed to fetch: %w", &StatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"not found", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"not implemented", &StatusError{StatusCode: http.StatusNotImplemented}, false},
+		{"feed server error", gofeed.HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"feed gone", gofeed.HTTPError{StatusCode: http.StatusGone}, false},
+		{"youtube backend error", &googleapi.Error{Code: http.StatusInternalServerError}, true},
+		{"youtube forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"truncated body", fmt.Errorf("failed to read: %w", io.ErrUnexpectedEOF), true},
+		{"permanent server error", permanent(&StatusError{StatusCode: http.StatusBadGateway}), false},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{"dns temporary", &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, true},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "nxdomain.invalid", IsNotFound: true}, false},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, false},
+		{"malformed response", errors.New("invalid character '<' looking for beginning of value"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientHTTPClientErrors(t *testing.T) {
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	_, err := client.Get(slow.URL)
+	if err == nil || !isTransient(err) {
+		t.Errorf("client timeout %v should be transient", err)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+	_, err = client.Get(closedURL)
+	if err == nil || isTransient(err) {
+		t.Errorf("refused connection %v should be permanent", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		calls := 0
+		attempts, err := retry(context.Background(), policy, "op", func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return &StatusError{StatusCode: http.StatusServiceUnavailable}
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("retry = %d, %v; want 3 attempts and no error", attempts, err)
+		}
+	})
+
+	t.Run("stops on permanent errors", func(t *testing.T) {
+		notFound := &StatusError{StatusCode: http.StatusNotFound}
+		attempts, err := retry(context.Background(), policy, "op", func(ctx context.Context) error {
+			return notFound
+		})
+		if !errors.Is(err, notFound) || attempts != 1 {
+			t.Errorf("retry = %d, %v; want 1 attempt and the 404", attempts, err)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		attempts, err := retry(context.Background(), policy, "op", func(ctx context.Context) error {
+			return &StatusError{StatusCode: http.StatusBadGateway}
+		})
+		if err == nil || attempts != policy.MaxRetries+1 {
+			t.Errorf("retry = %d, %v; want %d attempts and an error", attempts, err, policy.MaxRetries+1)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := RetryPolicy{MaxRetries: 5, Delay: time.Hour}
+		attempts, err := retry(ctx, slow, "op", func(ctx context.Context) error {
+			cancel()
+			return &StatusError{StatusCode: http.StatusBadGateway}
+		})
+		if err == nil || attempts != 1 {
+			t.Errorf("retry = %d, %v; want 1 attempt and an error", attempts, err)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: time.Second}
+	for attempt, want := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 12: maxRetryDelay} {
+		if want == 0 {
+			continue
+		}
+		for i := 0; i < 20; i++ {
+			if got := policy.backoff(attempt); got < want/2 || got > want {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, got, want/2, want)
+			}
+		}
+	}
+
+	if got := (RetryPolicy{}).backoff(1); got != 0 {
+		t.Errorf("backoff without delay = %v, want 0", got)
+	}
+}
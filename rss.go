@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/mmcdole/gofeed"
+)
+
+// defaultTeaserLength is the text length below which a feed item is
+// considered a teaser of the linked article
+const defaultTeaserLength = 500
+
+// RSSOptions control how feed items become documents
+type RSSOptions struct {
+	// FullContent prefers the full item content (content:encoded or Atom
+	// content) over the description
+	FullContent bool `json:"full_content,omitempty"`
+	// FetchArticles fetches the linked article through the web extractor
+	// when an item only has a teaser
+	FetchArticles bool `json:"fetch_articles,omitempty"`
+	// TeaserLength is the text length below which an item is a teaser
+	TeaserLength int `json:"teaser_length,omitempty"`
+	// PDFEnclosures ingests PDF enclosures as documents of their own
+	PDFEnclosures bool `json:"pdf_enclosures,omitempty"`
+}
+
+// itemKey identifies a feed item by its GUID, or its link without one
+func itemKey(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
+
+// feedItemContent maps a feed item to content, using its categories as tags
+// and keeping its authors in the metadata
+func feedItemContent(feed *gofeed.Feed, item *gofeed.Item, opts RSSOptions) Content {
+	publishedAt := time.Now()
+	if item.PublishedParsed != nil {
+		publishedAt = *item.PublishedParsed
+	} else if item.UpdatedParsed != nil {
+		publishedAt = *item.UpdatedParsed
+	}
+
+	body := item.Description
+	if opts.FullContent && strings.TrimSpace(item.Content) != "" {
+		body = item.Content
+	}
+
+	content := Content{
+		ID:          itemKey(item),
+		Title:       item.Title,
+		Text:        htmlMarkdown(body),
+		Source:      feed.Title,
+		URL:         item.Link,
+		PublishedAt: publishedAt,
+		Metadata:    Metadata{},
+	}
+
+	for _, category := range item.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			content.Tags = append(content.Tags, category)
+		}
+	}
+
+	var authors []string
+	for _, author := range item.Authors {
+		if author != nil && author.Name != "" {
+			authors = append(authors, author.Name)
+		}
+	}
+	if len(authors) == 0 && item.Author != nil && item.Author.Name != "" {
+		authors = append(authors, item.Author.Name)
+	}
+	if len(authors) > 0 {
+		content.Metadata["authors"] = authors
+	}
+
+	return content
+}
+
+// isTeaser reports whether content is too short to stand for its article
+func isTeaser(content Content, opts RSSOptions) bool {
+	length := opts.TeaserLength
+	if length <= 0 {
+		length = defaultTeaserLength
+	}
+	return utf8.RuneCountInString(content.Text) < length
+}
+
+// pdfEnclosures returns the URLs of the PDF enclosures of an item
+func pdfEnclosures(item *gofeed.Item) []string {
+	var urls []string
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		isPDF := strings.EqualFold(strings.TrimSpace(enclosure.Type), "application/pdf")
+		if u, err := url.Parse(enclosure.URL); err == nil && strings.EqualFold(path.Ext(u.Path), ".pdf") {
+			isPDF = true
+		}
+		if isPDF {
+			urls = append(urls, enclosure.URL)
+		}
+	}
+	return urls
+}
+
+// enrichItem replaces a teaser with the linked article and adds the PDF
+// enclosures of an item. An article or enclosure that can't be fetched comes
+// back with its error set, so the failure is recorded and the item is tried
+// again on the next run without failing the feed.
+func (p *RSSProcessor) enrichItem(ctx context.Context, item *gofeed.Item, content Content, opts RSSOptions) []Content {
+	if opts.FetchArticles && item.Link != "" && isTeaser(content, opts) {
+		page, err := p.web.fetchPage(ctx, item.Link, ExtractOptions{}, nil, 0)
+		switch {
+		case err != nil:
+			content.Err = fmt.Errorf("failed to fetch article: %w", err)
+		case utf8.RuneCountInString(page.Article.Text) > utf8.RuneCountInString(content.Text):
+			content.Text = page.Article.Text
+		}
+	}
+	contents := []Content{content}
+
+	if !opts.PDFEnclosures {
+		return contents
+	}
+	for _, enclosureURL := range pdfEnclosures(item) {
+		pdfContent, err := p.pdf.FetchURL(ctx, enclosureURL, nil)
+		if err != nil {
+			pdfContent = Content{
+				Title:    pdfTitle(enclosureURL),
+				URL:      enclosureURL,
+				Metadata: Metadata{},
+				Err:      fmt.Errorf("failed to fetch PDF enclosure: %w", err),
+			}
+		}
+		pdfContent.ID = enclosureURL
+		pdfContent.Source = content.Source
+		pdfContent.PublishedAt = content.PublishedAt
+		pdfContent.Tags = content.Tags
+		pdfContent.Metadata["item"] = content.ID
+		contents = append(contents, pdfContent)
+	}
+	return contents
+}
+
+// feedItemKey returns the key of the feed item content belongs to, which for
+// a PDF enclosure is the key of the item it is attached to
+func feedItemKey(content Content) string {
+	if item, ok := content.Metadata["item"].(string); ok {
+		return item
+	}
+	return contentKey(content)
+}
+
+// seenFeedItems returns the keys of the items of a feed that were processed
+// before
+func (i *Ingester) seenFeedItems(ctx context.Context, sourceID string) (map[string]bool, error) {
+	var guids []string
+	query := `SELECT guid FROM feed_items WHERE source_id = $1`
+	if err := i.db.SelectContext(ctx, &guids, query, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to load seen feed items: %w", err)
+	}
+
+	seen := make(map[string]bool, len(guids))
+	for _, guid := range guids {
+		seen[guid] = true
+	}
+	return seen, nil
+}
+
+// markFeedItemsSeen records processed feed items so later runs skip them
+func (i *Ingester) markFeedItemsSeen(ctx context.Context, sourceID string, guids []string) error {
+	if len(guids) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO feed_items (source_id, guid)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (source_id, guid) DO NOTHING`
+
+	if _, err := i.db.ExecContext(ctx, query, sourceID, pq.StringArray(guids)); err != nil {
+		return fmt.Errorf("failed to record seen feed items: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const articleText = "The full article explains every step of the release, from the first draft to the final review."
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+  <title>Example news</title>
+  <item>
+    <guid>teaser</guid>
+    <title>Release</title>
+    <link>%[1]s/article</link>
+    <description>Short teaser</description>
+    <category>news</category>
+    <category> </category>
+    <category>releases</category>
+  </item>
+  <item>
+    <guid>full</guid>
+    <title>Full story</title>
+    <link>%[1]s/unused</link>
+    <description>Short teaser</description>
+    <content:encoded><![CDATA[<p>The complete story is part of the feed and needs no article fetch.</p>]]></content:encoded>
+  </item>
+  <item>
+    <guid>broken</guid>
+    <title>Gone</title>
+    <link>%[1]s/missing</link>
+    <description>Short teaser</description>
+  </item>
+  <item>
+    <guid>docs</guid>
+    <title>Handbook</title>
+    <description>The handbook for this release is attached to this item as a PDF.</description>
+    <enclosure url="%[1]s/files/handbook.pdf" type="application/pdf" length="1"/>
+    <enclosure url="%[1]s/files/missing.pdf" type="application/pdf" length="1"/>
+    <enclosure url="%[1]s/cover.jpg" type="image/jpeg" length="1"/>
+  </item>
+</channel>
+</rss>`
+
+func TestRSSProcessorFetch(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, testFeed, server.URL)
+		case "/article":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><body><article><h1>Release</h1><p>%s</p></article></body></html>", articleText)
+		case "/files/handbook.pdf":
+			w.Write(buildPDF("<< /Title (Handbook) >>", "Handbook text"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	processor := &RSSProcessor{
+		client: server.Client(),
+		parser: gofeed.NewParser(),
+		web:    &WebProcessor{client: server.Client(), hosts: newHostLimiter(1, 0)},
+		pdf:    &PDFProcessor{client: server.Client()},
+	}
+	opts := RSSOptions{FullContent: true, FetchArticles: true, TeaserLength: 50, PDFEnclosures: true}
+
+	contents, err := processor.Fetch(context.Background(), server.URL+"/feed", opts, nil, nil)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	byID := map[string]Content{}
+	for _, content := range contents {
+		byID[content.ID] = content
+	}
+	if len(contents) != 6 || len(byID) != 6 {
+		t.Fatalf("got %d contents, want 4 items and 2 PDF enclosures", len(contents))
+	}
+
+	teaser := byID["teaser"]
+	if teaser.Err != nil || !strings.Contains(teaser.Text, articleText) {
+		t.Errorf("teaser text = %q, err = %v; want the linked article", teaser.Text, teaser.Err)
+	}
+	if !reflect.DeepEqual(teaser.Tags, []string{"news", "releases"}) || teaser.Source != "Example news" {
+		t.Errorf("tags = %v, source = %q", teaser.Tags, teaser.Source)
+	}
+	if full := byID["full"]; !strings.HasPrefix(full.Text, "The complete story") {
+		t.Errorf("full content text = %q, want the encoded content", full.Text)
+	}
+	if broken := byID["broken"]; broken.Err == nil {
+		t.Error("an item whose article can't be fetched should carry the error")
+	}
+
+	handbook := byID[server.URL+"/files/handbook.pdf"]
+	if handbook.Err != nil || handbook.Text != "Handbook text" || handbook.Metadata["item"] != "docs" {
+		t.Errorf("enclosure = %q, metadata = %v, err = %v", handbook.Text, handbook.Metadata, handbook.Err)
+	}
+	missing := byID[server.URL+"/files/missing.pdf"]
+	if missing.Err == nil || feedItemKey(missing) != "docs" {
+		t.Errorf("failed enclosure err = %v, item = %q; want an error for item docs", missing.Err, feedItemKey(missing))
+	}
+
+	// Items seen before are skipped, with their enclosures
+	seen := map[string]bool{"teaser": true, "docs": true}
+	contents, err = processor.Fetch(context.Background(), server.URL+"/feed", opts, seen, nil)
+	if err != nil {
+		t.Fatalf("second Fetch failed: %v", err)
+	}
+	var ids []string
+	for _, content := range contents {
+		ids = append(ids, content.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"full", "broken"}) {
+		t.Errorf("second fetch = %v, want only the unseen items", ids)
+	}
+}
+
+func TestIsTeaser(t *testing.T) {
+	tests := []struct {
+		text   string
+		length int
+		want   bool
+	}{
+		{"short", 0, true},
+		{strings.Repeat("x", defaultTeaserLength), 0, false},
+		{"ünïcödé", 8, true},
+		{"ünïcödé", 7, false},
+	}
+	for _, tt := range tests {
+		if got := isTeaser(Content{Text: tt.text}, RSSOptions{TeaserLength: tt.length}); got != tt.want {
+			t.Errorf("isTeaser(%d runes, %d) = %v, want %v", len([]rune(tt.text)), tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestPDFEnclosures(t *testing.T) {
+	item := &gofeed.Item{Enclosures: []*gofeed.Enclosure{
+		{URL: "https://example.com/a.pdf"},
+		{URL: "https://example.com/download?id=2", Type: "application/PDF"},
+		{URL: "https://example.com/b.PDF?v=1", Type: "application/octet-stream"},
+		{URL: "https://example.com/episode.mp3", Type: "audio/mpeg"},
+		{URL: "", Type: "application/pdf"},
+		nil,
+	}}
+	want := []string{"https://example.com/a.pdf", "https://example.com/download?id=2", "https://example.com/b.PDF?v=1"}
+	if got := pdfEnclosures(item); !reflect.DeepEqual(got, want) {
+		t.Errorf("pdfEnclosures = %v, want %v", got, want)
+	}
+}
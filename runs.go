@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Ingestion run states
+const (
+	RunStatusQueued    = "queued"
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	RunStatusPartial   = "partial"
+)
+
+// What started an ingestion run
+const (
+	RunTriggerSchedule = "schedule"
+	RunTriggerManual   = "manual"
+)
+
+// IngestionRun records one processing of a knowledge source
+type IngestionRun struct {
+	ID                 int         `db:"id" json:"id"`
+	SourceID           string      `db:"source_id" json:"source_id"`
+	Status             string      `db:"status" json:"status"`
+	Trigger            string      `db:"trigger" json:"trigger"`
+	QueuedAt           time.Time   `db:"queued_at" json:"queued_at"`
+	StartedAt          *time.Time  `db:"started_at" json:"started_at,omitempty"`
+	FinishedAt         *time.Time  `db:"finished_at" json:"finished_at,omitempty"`
+	DurationMS         *int64      `db:"duration_ms" json:"duration_ms,omitempty"`
+	Attempts           int         `db:"attempts" json:"attempts"`
+	NotModified        bool        `db:"not_modified" json:"not_modified"`
+	ItemsFetched       int         `db:"items_fetched" json:"items_fetched"`
+	DocumentsAdded     int         `db:"documents_added" json:"documents_added"`
+	DocumentsUpdated   int         `db:"documents_updated" json:"documents_updated"`
+	DocumentsUnchanged int         `db:"documents_unchanged" json:"documents_unchanged"`
+	DocumentsRemoved   int         `db:"documents_removed" json:"documents_removed"`
+	DocumentsFailed    int         `db:"documents_failed" json:"documents_failed"`
+	ChunksAdded        int         `db:"chunks_added" json:"chunks_added"`
+	Error              string      `db:"error" json:"error,omitempty"`
+	Failures           RunFailures `db:"failures" json:"failures,omitempty"`
+}
+
+// RunFailure describes an item that could not be ingested during a run
+type RunFailure struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+// RunFailures is stored as a JSON array in the failures column
+type RunFailures []RunFailure
+
+// Value implements the driver.Valuer interface
+func (f RunFailures) Value() (driver.Value, error) {
+	if f == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal run failures: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (f *RunFailures) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return fmt.Errorf("cannot scan %T into RunFailures", src)
+	}
+}
+
+// RunStats accumulates the outcome of processing a source
+type RunStats struct {
+	Attempts           int
+	NotModified        bool
+	ItemsFetched       int
+	DocumentsAdded     int
+	DocumentsUpdated   int
+	DocumentsUnchanged int
+	DocumentsRemoved   int
+	DocumentsFailed    int
+	ChunksAdded        int
+	Failures           RunFailures
+}
+
+// addFailure records an item that failed to ingest
+func (s *RunStats) addFailure(item string, err error) {
+	s.DocumentsFailed++
+	s.Failures = append(s.Failures, RunFailure{Item: item, Error: err.Error()})
+}
+
+// addOutcome counts a successfully indexed document
+func (s *RunStats) addOutcome(outcome string, chunks int) {
+	switch outcome {
+	case IndexAdded:
+		s.DocumentsAdded++
+	case IndexUpdated:
+		s.DocumentsUpdated++
+	case IndexUnchanged:
+		s.DocumentsUnchanged++
+	}
+	s.ChunksAdded += chunks
+}
+
+// indexed returns the number of documents that are up to date after the run
+func (s *RunStats) indexed() int {
+	return s.DocumentsAdded + s.DocumentsUpdated + s.DocumentsUnchanged
+}
+
+// runStatus derives the final state of a run from its outcome
+func runStatus(stats RunStats, err error) string {
+	switch {
+	case err != nil:
+		return RunStatusFailed
+	case stats.DocumentsFailed > 0 && stats.indexed() == 0:
+		return RunStatusFailed
+	case stats.DocumentsFailed > 0:
+		return RunStatusPartial
+	default:
+		return RunStatusSucceeded
+	}
+}
+
+// runColumns lists the ingestion_runs columns scanned into an IngestionRun
+const runColumns = `id, source_id, status, trigger, queued_at, started_at, finished_at, duration_ms,
+		attempts, not_modified, items_fetched, documents_added, documents_updated, documents_unchanged, documents_removed,
+		documents_failed, chunks_added, error, failures`
+
+// enqueueRun records a queued run for a source
+func (i *Ingester) enqueueRun(ctx context.Context, sourceID, trigger string) (*IngestionRun, error) {
+	query := `
+		INSERT INTO ingestion_runs (source_id, status, trigger, queued_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		RETURNING ` + runColumns
+
+	var run IngestionRun
+	if err := i.db.GetContext(ctx, &run, query, sourceID, RunStatusQueued, trigger); err != nil {
+		return nil, fmt.Errorf("failed to create ingestion run: %w", err)
+	}
+
+	return &run, nil
+}
+
+// markRunStarted moves a run into the running state
+func (i *Ingester) markRunStarted(ctx context.Context, runID int) error {
+	query := `UPDATE ingestion_runs SET status = $2, started_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := i.db.ExecContext(ctx, query, runID, RunStatusRunning); err != nil {
+		return fmt.Errorf("failed to start ingestion run: %w", err)
+	}
+	return nil
+}
+
+// finishRun records the outcome of a run
+func (i *Ingester) finishRun(ctx context.Context, runID int, status string, stats RunStats, runErr error) error {
+	errMsg := ""
+	if runErr != nil {
+		errMsg = runErr.Error()
+	}
+
+	query := `
+		UPDATE ingestion_runs
+		SET status = $2,
+			finished_at = CURRENT_TIMESTAMP,
+			duration_ms = (EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - started_at)) * 1000)::BIGINT,
+			attempts = $3,
+			not_modified = $4,
+			items_fetched = $5,
+			documents_added = $6,
+			documents_updated = $7,
+			documents_unchanged = $8,
+			documents_removed = $9,
+			documents_failed = $10,
+			chunks_added = $11,
+			error = $12,
+			failures = $13
+		WHERE id = $1`
+
+	_, err := i.db.ExecContext(ctx, query, runID,
+		status,
+		stats.Attempts,
+		stats.NotModified,
+		stats.ItemsFetched,
+		stats.DocumentsAdded,
+		stats.DocumentsUpdated,
+		stats.DocumentsUnchanged,
+		stats.DocumentsRemoved,
+		stats.DocumentsFailed,
+		stats.ChunksAdded,
+		errMsg,
+		stats.Failures,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish ingestion run: %w", err)
+	}
+
+	return nil
+}
+
+// executeRun processes the source of a queued run and records the outcome
+func (i *Ingester) executeRun(source Source, run *IngestionRun) {
+	ctx := context.Background()
+	if err := i.markRunStarted(ctx, run.ID); err != nil {
+		log.Printf("Error starting run %d for source %s: %v", run.ID, source.ID, err)
+	}
+
+	stats, err := i.processSource(ctx, source)
+	if err != nil {
+		log.Printf("Error processing source %s: %v", source.ID, err)
+	}
+
+	status := runStatus(stats, err)
+	if finishErr := i.finishRun(ctx, run.ID, status, stats, err); finishErr != nil {
+		log.Printf("Error finishing run %d for source %s: %v", run.ID, source.ID, finishErr)
+	}
+
+	if status == RunStatusFailed {
+		reason := "no content could be indexed"
+		if err != nil {
+			reason = err.Error()
+		} else if len(stats.Failures) > 0 {
+			reason = stats.Failures[0].Error
+		}
+		err = i.recordSourceFailure(ctx, source.ID, reason)
+	} else {
+		err = i.resetSourceFailures(ctx, source.ID)
+	}
+	if err != nil {
+		log.Printf("Error recording outcome of run %d for source %s: %v", run.ID, source.ID, err)
+	}
+}
+
+// recordSourceFailure counts a failed run and dead-letters the source once
+// it has failed SourcesConfig.MaxConsecutiveFailures times in a row
+func (i *Ingester) recordSourceFailure(ctx context.Context, sourceID, reason string) error {
+	query := `
+		UPDATE knowledge_sources
+		SET consecutive_failures = consecutive_failures + 1
+		WHERE id = $1
+		RETURNING consecutive_failures`
+
+	var failures int
+	if err := i.db.GetContext(ctx, &failures, query, sourceID); err != nil {
+		return fmt.Errorf("failed to count source failure: %w", err)
+	}
+
+	limit := i.cfg.Sources.MaxConsecutiveFailures
+	if limit <= 0 || failures < limit {
+		return nil
+	}
+	return i.deadLetterSource(ctx, sourceID, fmt.Sprintf("%d consecutive failed runs, last error: %s", failures, reason))
+}
+
+// deadLetterSource deactivates a source that keeps failing and records why
+func (i *Ingester) deadLetterSource(ctx context.Context, sourceID, reason string) error {
+	query := `
+		UPDATE knowledge_sources
+		SET active = false, dead_lettered_at = CURRENT_TIMESTAMP, dead_letter_reason = $2
+		WHERE id = $1`
+
+	if _, err := i.db.ExecContext(ctx, query, sourceID, reason); err != nil {
+		return fmt.Errorf("failed to dead-letter source: %w", err)
+	}
+
+	i.unscheduleSource(sourceID)
+	log.Printf("Source %s moved to dead letter and deactivated: %s", sourceID, reason)
+	return nil
+}
+
+// resetSourceFailures clears the failure count after a successful run
+func (i *Ingester) resetSourceFailures(ctx context.Context, sourceID string) error {
+	query := `UPDATE knowledge_sources SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0`
+	if _, err := i.db.ExecContext(ctx, query, sourceID); err != nil {
+		return fmt.Errorf("failed to reset source failures: %w", err)
+	}
+	return nil
+}
+
+// errRunInProgress is returned when a source already has a queued or running run
+var errRunInProgress = errors.New("source already has a queued or running run")
+
+// queuedRun is a run waiting for a worker
+type queuedRun struct {
+	source Source
+	run    *IngestionRun
+}
+
+// runSource queues a run for a source unless one is already queued or
+// running. The run is processed by the next free worker.
+func (i *Ingester) runSource(source Source, trigger string) (*IngestionRun, error) {
+	i.mu.Lock()
+	if i.inFlight[source.ID] {
+		i.mu.Unlock()
+		return nil, errRunInProgress
+	}
+	i.inFlight[source.ID] = true
+	i.mu.Unlock()
+
+	run, err := i.enqueueRun(context.Background(), source.ID, trigger)
+	if err != nil {
+		i.clearInFlight(source.ID)
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case i.queue <- queuedRun{source: source, run: run}:
+		case <-i.done:
+			i.clearInFlight(source.ID)
+		}
+	}()
+
+	return run, nil
+}
+
+// worker processes queued runs until the ingester is stopped
+func (i *Ingester) worker() {
+	defer i.workers.Done()
+
+	for {
+		select {
+		case job := <-i.queue:
+			i.executeRun(job.source, job.run)
+			i.clearInFlight(job.source.ID)
+		case <-i.done:
+			return
+		}
+	}
+}
+
+// clearInFlight allows new runs of a source to be queued
+func (i *Ingester) clearInFlight(sourceID string) {
+	i.mu.Lock()
+	delete(i.inFlight, sourceID)
+	i.mu.Unlock()
+}
+
+// failInterruptedRuns marks runs left queued or running by a previous
+// process as failed
+func (i *Ingester) failInterruptedRuns(ctx context.Context) error {
+	query := `
+		UPDATE ingestion_runs
+		SET status = $1, finished_at = CURRENT_TIMESTAMP, error = 'interrupted by shutdown'
+		WHERE status IN ($2, $3)`
+
+	if _, err := i.db.ExecContext(ctx, query, RunStatusFailed, RunStatusQueued, RunStatusRunning); err != nil {
+		return fmt.Errorf("failed to clean up interrupted runs: %w", err)
+	}
+	return nil
+}
+
+// ListRuns returns recent runs, optionally limited to one source and/or status
+func (i *Ingester) ListRuns(ctx context.Context, sourceID, status string, limit int) ([]IngestionRun, error) {
+	query := `
+		SELECT ` + runColumns + `
+		FROM ingestion_runs
+		WHERE ($1 = '' OR source_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY queued_at DESC, id DESC
+		LIMIT $3`
+
+	runs := []IngestionRun{}
+	if err := i.db.SelectContext(ctx, &runs, query, sourceID, status, limit); err != nil {
+		return nil, fmt.Errorf("failed to list ingestion runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetRun retrieves a single ingestion run
+func (i *Ingester) GetRun(ctx context.Context, runID int) (*IngestionRun, error) {
+	query := `SELECT ` + runColumns + ` FROM ingestion_runs WHERE id = $1`
+
+	var run IngestionRun
+	if err := i.db.GetContext(ctx, &run, query, runID); err != nil {
+		return nil, fmt.Errorf("failed to get ingestion run: %w", err)
+	}
+
+	return &run, nil
+}
+
+// listSourceRunsHandler returns the run history of a source
+func listSourceRunsHandler(w http.ResponseWriter, r *http.Request) {
+	source, err := ingester.GetSource(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	runs, err := ingester.ListRuns(r.Context(), source.ID, r.URL.Query().Get("status"), queryInt(r, "limit", 50))
+	if err != nil {
+		log.Printf("Error listing runs for %s: %v", source.ID, err)
+		http.Error(w, "Failed to list runs", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// listRunsHandler returns recent runs across all sources, e.g. ?status=failed
+func listRunsHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := ingester.ListRuns(r.Context(), "", r.URL.Query().Get("status"), queryInt(r, "limit", 50))
+	if err != nil {
+		log.Printf("Error listing runs: %v", err)
+		http.Error(w, "Failed to list runs", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// getRunHandler returns a run including its per-item failures
+func getRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid run ID", http.StatusBadRequest)
+		return
+	}
+
+	run, err := ingester.GetRun(r.Context(), runID)
+	if err != nil {
+		writeLookupError(w, "run", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats RunStats
+		err   error
+		want  string
+	}{
+		{"nothing to do", RunStats{}, nil, RunStatusSucceeded},
+		{"not modified", RunStats{NotModified: true}, nil, RunStatusSucceeded},
+		{"all indexed", RunStats{DocumentsAdded: 2, DocumentsUnchanged: 1}, nil, RunStatusSucceeded},
+		{"some failed", RunStats{DocumentsUpdated: 1, DocumentsFailed: 1}, nil, RunStatusPartial},
+		{"all failed", RunStats{DocumentsFailed: 3}, nil, RunStatusFailed},
+		{"run error", RunStats{DocumentsAdded: 2}, errors.New("fetch failed"), RunStatusFailed},
+	}
+	for _, tt := range tests {
+		if got := runStatus(tt.stats, tt.err); got != tt.want {
+			t.Errorf("%s: runStatus = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunStatsOutcomes(t *testing.T) {
+	var stats RunStats
+	stats.addOutcome(IndexAdded, 3)
+	stats.addOutcome(IndexAdded, 2)
+	stats.addOutcome(IndexUpdated, 4)
+	stats.addOutcome(IndexUnchanged, 0)
+	stats.addFailure("https://example.com/broken", errors.New("status 500"))
+
+	want := RunStats{
+		DocumentsAdded:     2,
+		DocumentsUpdated:   1,
+		DocumentsUnchanged: 1,
+		DocumentsFailed:    1,
+		ChunksAdded:        9,
+		Failures:           RunFailures{{Item: "https://example.com/broken", Error: "status 500"}},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if stats.indexed() != 4 {
+		t.Errorf("indexed = %d, want 4", stats.indexed())
+	}
+}
+
+func TestRunFailuresValue(t *testing.T) {
+	var none RunFailures
+	if value, err := none.Value(); err != nil || value != "[]" {
+		t.Errorf("Value of no failures = %v, %v; want an empty array", value, err)
+	}
+
+	failures := RunFailures{{Item: "a.pdf", Error: "no text"}, {Item: "b.md", Error: "timeout"}}
+	value, err := failures.Value()
+	if err != nil {
+		t.Fatalf("Value failed: %v", err)
+	}
+
+	for _, src := range []interface{}{value, []byte(value.(string))} {
+		var scanned RunFailures
+		if err := scanned.Scan(src); err != nil || !reflect.DeepEqual(scanned, failures) {
+			t.Errorf("Scan(%T) = %v, %v; want %v", src, scanned, err, failures)
+		}
+	}
+
+	scanned := failures
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("Scan(nil) = %v, %v; want no failures", scanned, err)
+	}
+	if err := scanned.Scan(42); err == nil {
+		t.Error("Scan of an int should fail")
+	}
+}
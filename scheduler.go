@@ -46,19 +46,16 @@ func updateKnowledgeBase(db *DB) error {
 			continue
 		}
 
-		// Generate embedding
-		embedding, err := generateEmbedding(update.Content)
-		if err != nil {
-			log.Printf("Failed to generate embedding for document %d: %v", i, err)
-			continue
-		}
-
 		// Create unique document ID
 		docID := fmt.Sprintf("doc_%s_%d", update.Source, update.UpdatedAt.Unix())
 
-		// Add document to database
-		err = db.AddDocument(context.Background(), docID, update.Content, embedding)
-		if err != nil {
+		// Chunk, embed and store the document
+		content := Content{
+			Text:        update.Content,
+			Source:      update.Source,
+			PublishedAt: update.UpdatedAt,
+		}
+		if _, _, err := db.IndexContent(context.Background(), docID, content); err != nil {
 			log.Printf("Failed to add document %d: %v", i, err)
 			continue
 		}
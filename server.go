@@ -1,14 +1,18 @@
 package main
 
 import (
-	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/mohammedrefaat/smart-ai-assistant/config"
 )
 
@@ -17,12 +21,34 @@ var db *DB
 
 // Document represents a document in the knowledge base
 type Document struct {
-	ID        int       `db:"id"`
-	DocID     string    `db:"doc_id"`
-	Content   string    `db:"content"`
-	Embedding []float64 `db:"embedding"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID          int            `db:"id"`
+	DocID       string         `db:"doc_id"`
+	ParentDocID string         `db:"parent_doc_id"`
+	ChunkIndex  int            `db:"chunk_index"`
+	StartOffset int            `db:"start_offset"`
+	EndOffset   int            `db:"end_offset"`
+	Content     string         `db:"content"`
+	Embedding   Vector         `db:"embedding"`
+	Title       string         `db:"title"`
+	URL         string         `db:"url"`
+	Source      string         `db:"source"`
+	SourceType  string         `db:"source_type"`
+	SourceID    sql.NullString `db:"source_id"`
+	PublishedAt sql.NullTime   `db:"published_at"`
+	Tags        pq.StringArray `db:"tags"`
+	Metadata    Metadata       `db:"metadata"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+	Similarity  float64        `db:"similarity"`
+	KeywordRank float64        `db:"keyword_rank"`
+	Score       float64        `db:"-"`
+}
+
+// location returns the label of where the chunk starts in its document,
+// such as "p. 14"
+func (d Document) location() string {
+	location, _ := d.Metadata["location"].(string)
+	return location
 }
 
 // DB wraps sqlx.DB to provide custom functionality
@@ -35,16 +61,26 @@ type DB struct {
 
 // ChatRequest represents the incoming chat request
 type ChatRequest struct {
-	Query string `json:"query"`
+	Query          string          `json:"query"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	Filter         *DocumentFilter `json:"filter,omitempty"`
+	SearchMode     string          `json:"search_mode,omitempty"`
 }
 
 // ChatResponse represents the outgoing chat response
 type ChatResponse struct {
-	Response string   `json:"response"`
-	Sources  []string `json:"sources,omitempty"`
+	Response       string      `json:"response"`
+	Sources        []SourceRef `json:"sources,omitempty"`
+	ConversationID string      `json:"conversation_id"`
+}
+
+// ChatChunk is a piece of a streamed chat response
+type ChatChunk struct {
+	Response string `json:"response"`
 }
 
-// chatHandler processes incoming chat requests
+// chatHandler processes incoming chat requests. Clients that send
+// "Accept: text/event-stream" receive the answer as Server-Sent Events.
 func chatHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -58,49 +94,181 @@ func chatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	queryEmbedding, err := generateEmbedding(req.Query)
+	if !validSearchMode(req.SearchMode) {
+		http.Error(w, fmt.Sprintf("Unknown search mode: %s", req.SearchMode), http.StatusBadRequest)
+		return
+	}
+
+	conv, history, err := loadConversation(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Failed to generate embedding", http.StatusInternalServerError)
+		writeLookupError(w, "conversation", err)
 		return
 	}
 
-	docs, err := QuerySimilarDocuments(context.Background(), queryEmbedding, 10, 0.5, db)
+	docs, err := retrieveDocuments(r.Context(), retrievalQuery(history, req.Query), req.SearchMode, req.Filter)
 	if err != nil {
+		log.Printf("Error retrieving context: %v", err)
 		http.Error(w, "Failed to retrieve context", http.StatusInternalServerError)
 		return
 	}
 
-	var contexts []string
-	var sources []string
-	for _, doc := range docs {
-		contexts = append(contexts, doc.Content)
-		sources = append(sources, doc.DocID)
+	prompt := buildPrompt(docs, history, req.Query)
+
+	if wantsEventStream(r) {
+		streamChatResponse(w, r, conv, req.Query, prompt, docs)
+		return
 	}
 
-	prompt := buildPrompt(contexts, req.Query)
-	response, err := generateText(prompt)
+	response, err := llm.Generate(r.Context(), prompt)
 	if err != nil {
 		http.Error(w, "Failed to generate response", http.StatusInternalServerError)
 		return
 	}
 
+	sources := buildSources(docs, response)
+	saveExchange(r.Context(), conv, req.Query, response, sources)
+
 	chatResp := ChatResponse{
-		Response: response,
-		Sources:  sources,
+		Response:       response,
+		Sources:        sources,
+		ConversationID: conv.ID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(chatResp)
 }
 
-// buildPrompt creates the prompt for text generation
-func buildPrompt(contexts []string, query string) string {
-	return fmt.Sprintf(`Use the following information to answer the question:
+// wantsEventStream reports whether the client asked for a streamed response
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// streamChatResponse forwards generated tokens to the client as "token"
+// events and finishes with a "done" event carrying the full ChatResponse.
+// Failures after the stream has started are reported as an "error" event.
+func streamChatResponse(w http.ResponseWriter, r *http.Request, conv *Conversation, query, prompt string, docs []Document) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Generation can outlast the server's WriteTimeout, so lift the deadline
+	// for this response only.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing write deadline: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var response strings.Builder
+	err := llm.GenerateStream(r.Context(), prompt, func(token string) error {
+		response.WriteString(token)
+		return writeEvent(w, flusher, "token", ChatChunk{Response: token})
+	})
+	if err != nil {
+		log.Printf("Error streaming response: %v", err)
+		writeEvent(w, flusher, "error", map[string]string{"error": "Failed to generate response"})
+		return
+	}
+
+	sources := buildSources(docs, response.String())
+	saveExchange(r.Context(), conv, query, response.String(), sources)
+
+	writeEvent(w, flusher, "done", ChatResponse{
+		Response:       response.String(),
+		Sources:        sources,
+		ConversationID: conv.ID,
+	})
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return fmt.Errorf("error writing event: %w", err)
+	}
+	flusher.Flush()
+
+	return nil
+}
+
+// queryInt reads a non-negative integer query parameter, falling back to def
+func queryInt(r *http.Request, name string, def int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || value < 0 {
+		return def
+	}
+	return value
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeLookupError maps a failed lookup to 404 or 500
+func writeLookupError(w http.ResponseWriter, resource string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("%s not found", strings.ToUpper(resource[:1])+resource[1:]), http.StatusNotFound)
+		return
+	}
+	log.Printf("Error looking up %s: %v", resource, err)
+	http.Error(w, fmt.Sprintf("Failed to get %s", resource), http.StatusInternalServerError)
+}
+
+// buildPrompt creates the prompt for text generation. Context documents are
+// numbered so the model can cite them as [n], and prior conversation turns
+// are included so follow-up questions can be resolved.
+func buildPrompt(docs []Document, history []Message, query string) string {
+	var contexts []string
+	for i, doc := range docs {
+		var block strings.Builder
+		fmt.Fprintf(&block, "[%d]", i+1)
+		if doc.Title != "" {
+			fmt.Fprintf(&block, " %s", doc.Title)
+		}
+		if location := doc.location(); location != "" {
+			fmt.Fprintf(&block, ", %s", location)
+		}
+		if doc.URL != "" {
+			fmt.Fprintf(&block, " (%s)", doc.URL)
+		}
+		fmt.Fprintf(&block, "\n%s", doc.Content)
+		contexts = append(contexts, block.String())
+	}
+
+	var conversation strings.Builder
+	if len(history) > 0 {
+		conversation.WriteString("Conversation so far:\n")
+		for _, msg := range history {
+			role := "User"
+			if msg.Role == MessageRoleAssistant {
+				role = "Assistant"
+			}
+			fmt.Fprintf(&conversation, "%s: %s\n", role, msg.Content)
+		}
+		conversation.WriteString("\n")
+	}
+
+	return fmt.Sprintf(`Use the following numbered sources to answer the question. After each statement that uses a source, cite it by its number in square brackets, for example [1] or [2][3]. Only cite sources that support the statement.
 
 Context:
 %s
 
-Question: %s
+%sQuestion: %s
 
-Answer:`, strings.Join(contexts, "\n\n"), query)
+Answer:`, strings.Join(contexts, "\n\n"), conversation.String(), query)
 }
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/jmoiron/sqlx"
+	"github.com/robfig/cron/v3"
+)
+
+// Global ingester instance
+var ingester *Ingester
+
+// sourceColumns lists the knowledge_sources columns scanned into a Source
+const sourceColumns = `id, type, url, schedule, options, last_updated, active, created_at,
+		consecutive_failures, dead_lettered_at, dead_letter_reason`
+
+// SourceOptions holds the type specific settings of a source
+type SourceOptions struct {
+	// Extract overrides main-content detection for web pages
+	Extract *ExtractOptions `json:"extract,omitempty"`
+	// Crawl sets the scope of crawl sources
+	Crawl *CrawlOptions `json:"crawl,omitempty"`
+	// API maps the responses of API sources to documents
+	API *APIOptions `json:"api,omitempty"`
+	// YouTube sets caption languages and video limits of YouTube sources
+	YouTube *YouTubeOptions `json:"youtube,omitempty"`
+	// RSS selects item content, article fetching and enclosures of feeds
+	RSS *RSSOptions `json:"rss,omitempty"`
+	// Directory selects the files of directory sources
+	Directory *DirectoryOptions `json:"directory,omitempty"`
+	// Git selects the ref and files of git sources
+	Git *GitOptions `json:"git,omitempty"`
+}
+
+// extract returns the extraction options, or the defaults when unset
+func (o SourceOptions) extract() ExtractOptions {
+	if o.Extract == nil {
+		return ExtractOptions{}
+	}
+	return *o.Extract
+}
+
+// crawl returns the crawl options with defaults filled in
+func (o SourceOptions) crawl() CrawlOptions {
+	var opts CrawlOptions
+	if o.Crawl != nil {
+		opts = *o.Crawl
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultCrawlDepth
+	}
+	if opts.MaxPages <= 0 {
+		opts.MaxPages = defaultCrawlPages
+	}
+	return opts
+}
+
+// api returns the API mapping, or the defaults when unset
+func (o SourceOptions) api() APIOptions {
+	if o.API == nil {
+		return APIOptions{}
+	}
+	return *o.API
+}
+
+// youtube returns the YouTube options; the processor fills in defaults
+func (o SourceOptions) youtube() YouTubeOptions {
+	if o.YouTube == nil {
+		return YouTubeOptions{}
+	}
+	return *o.YouTube
+}
+
+// rss returns the feed options, or the defaults when unset
+func (o SourceOptions) rss() RSSOptions {
+	if o.RSS == nil {
+		return RSSOptions{}
+	}
+	return *o.RSS
+}
+
+// directory returns the file selection, or the defaults when unset
+func (o SourceOptions) directory() DirectoryOptions {
+	if o.Directory == nil {
+		return DirectoryOptions{}
+	}
+	return *o.Directory
+}
+
+// git returns the repository options, or the defaults when unset
+func (o SourceOptions) git() GitOptions {
+	if o.Git == nil {
+		return GitOptions{}
+	}
+	return *o.Git
+}
+
+// redacted returns the options with credentials masked for API responses
+func (o SourceOptions) redacted() SourceOptions {
+	if o.API != nil && o.API.Auth != nil {
+		api := *o.API
+		auth := api.Auth.redacted()
+		api.Auth = &auth
+		o.API = &api
+	}
+	return o
+}
+
+// restoreSecrets keeps the stored credentials that an update sends back
+// masked
+func (o *SourceOptions) restoreSecrets(stored SourceOptions) {
+	if o.API != nil && o.API.Auth != nil && stored.API != nil {
+		o.API.Auth.restoreSecrets(stored.API.Auth)
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (o SourceOptions) Value() (driver.Value, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal source options: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (o *SourceOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o = SourceOptions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	default:
+		return fmt.Errorf("cannot scan %T into SourceOptions", src)
+	}
+}
+
+// errInvalidSource is returned when a source fails validation
+var errInvalidSource = errors.New("invalid source")
+
+// SourceRequest is the body of create and update source requests. Nil
+// fields are left unchanged on update.
+type SourceRequest struct {
+	Type     string         `json:"type"`
+	URL      string         `json:"url"`
+	Schedule *string        `json:"schedule,omitempty"`
+	Active   *bool          `json:"active,omitempty"`
+	Options  *SourceOptions `json:"options,omitempty"`
+}
+
+// validateSource checks the source type, URL and cron schedule
+func validateSource(source Source) error {
+	if !slices.Contains(sourceTypes, source.Type) {
+		return fmt.Errorf("%w: unknown type %q, expected one of %s",
+			errInvalidSource, source.Type, strings.Join(sourceTypes, ", "))
+	}
+
+	if strings.TrimSpace(source.URL) == "" {
+		return fmt.Errorf("%w: url is required", errInvalidSource)
+	}
+
+	switch source.Type {
+	case SourceTypeAPI, SourceTypeLink, SourceTypeRSS, SourceTypeCrawl:
+		u, err := url.ParseRequestURI(source.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: url must be an absolute http(s) URL", errInvalidSource)
+		}
+	case SourceTypeDirectory:
+		if !filepath.IsAbs(source.URL) {
+			return fmt.Errorf("%w: url must be an absolute directory path", errInvalidSource)
+		}
+	case SourceTypeGit:
+		if !isGitRemote(source.URL) {
+			return fmt.Errorf("%w: url must be a local repository path or a file, http(s), ssh or git URL", errInvalidSource)
+		}
+	case SourceTypeYouTube:
+		if _, err := parseYouTubeTarget(source.URL); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidSource, err)
+		}
+	}
+
+	if _, err := cron.ParseStandard(source.Schedule); err != nil {
+		return fmt.Errorf("%w: schedule %q is not a valid cron expression: %v", errInvalidSource, source.Schedule, err)
+	}
+
+	return validateOptions(source.Options)
+}
+
+// validateSourcePath checks that the local path of a source is inside one of
+// allowedPaths
+func validateSourcePath(source Source, allowedPaths []string) error {
+	if err := checkSourcePath(source, allowedPaths); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidSource, err)
+	}
+	return nil
+}
+
+// localSourcePath returns the path on the server that a source reads, if
+// it reads one
+func localSourcePath(source Source) (string, bool) {
+	switch source.Type {
+	case SourceTypeDirectory:
+		return source.URL, true
+	case SourceTypeGit:
+		return gitLocalPath(source.URL)
+	case SourceTypeText, SourceTypePDF:
+		if strings.HasPrefix(source.URL, "http://") || strings.HasPrefix(source.URL, "https://") {
+			return "", false
+		}
+		return source.URL, true
+	}
+	return "", false
+}
+
+// checkSourcePath rejects sources reading local paths outside the allowed
+// directories. Symlinks are resolved first, so a link inside an allowed
+// directory can't point outside of it.
+func checkSourcePath(source Source, allowedPaths []string) error {
+	path, ok := localSourcePath(source)
+	if !ok {
+		return nil
+	}
+	resolved := resolvePath(path)
+	for _, root := range allowedPaths {
+		rel, err := filepath.Rel(resolvePath(root), resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("path %s is not inside sources.allowedPaths", path)
+}
+
+// resolvePath makes a path absolute and resolves the symlinks of the part
+// of it that exists
+func resolvePath(path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// validateOptions checks the type specific settings of a source
+func validateOptions(opts SourceOptions) error {
+	extract := opts.extract()
+	selectors := extract.RemoveSelectors
+	if extract.ContentSelector != "" {
+		selectors = append(selectors, extract.ContentSelector)
+	}
+	for _, selector := range selectors {
+		if _, err := cascadia.ParseGroup(selector); err != nil {
+			return fmt.Errorf("%w: invalid CSS selector %q: %v", errInvalidSource, selector, err)
+		}
+	}
+
+	if crawl := opts.Crawl; crawl != nil {
+		if crawl.MaxDepth < 0 || crawl.MaxPages < 0 {
+			return fmt.Errorf("%w: crawl max_depth and max_pages must not be negative", errInvalidSource)
+		}
+		if crawl.PathPrefix != "" && !strings.HasPrefix(crawl.PathPrefix, "/") {
+			return fmt.Errorf("%w: crawl path_prefix must start with /", errInvalidSource)
+		}
+		for _, domain := range crawl.Domains {
+			if strings.TrimSpace(domain) == "" || strings.ContainsAny(domain, "/:") {
+				return fmt.Errorf("%w: crawl domain %q must be a host name", errInvalidSource, domain)
+			}
+		}
+	}
+
+	if yt := opts.YouTube; yt != nil && yt.MaxVideos < 0 {
+		return fmt.Errorf("%w: youtube max_videos must not be negative", errInvalidSource)
+	}
+
+	if rss := opts.RSS; rss != nil && rss.TeaserLength < 0 {
+		return fmt.Errorf("%w: rss teaser_length must not be negative", errInvalidSource)
+	}
+
+	if dir := opts.Directory; dir != nil {
+		for _, pattern := range append(slices.Clone(dir.Include), dir.Exclude...) {
+			if err := validateGlob(pattern); err != nil {
+				return fmt.Errorf("%w: directory: %v", errInvalidSource, err)
+			}
+		}
+	}
+
+	if git := opts.Git; git != nil {
+		if strings.HasPrefix(git.Ref, "-") || strings.ContainsAny(git.Ref, " \t\n~^:?*[\\") {
+			return fmt.Errorf("%w: git ref %q is not a valid branch or tag name", errInvalidSource, git.Ref)
+		}
+		for _, pattern := range append(slices.Clone(git.Include), git.Exclude...) {
+			if err := validateGlob(pattern); err != nil {
+				return fmt.Errorf("%w: git: %v", errInvalidSource, err)
+			}
+		}
+	}
+
+	if opts.API != nil {
+		if err := opts.API.validate(); err != nil {
+			return fmt.Errorf("%w: api: %v", errInvalidSource, err)
+		}
+	}
+
+	return nil
+}
+
+// AddSource validates and adds a new knowledge source. An empty schedule
+// falls back to the configured default schedule.
+func (i *Ingester) AddSource(ctx context.Context, sourceType, sourceURL, schedule string, active bool, options SourceOptions) (*Source, error) {
+	if schedule == "" {
+		schedule = i.cfg.Sources.DefaultSchedule
+	}
+
+	source := Source{
+		ID:       fmt.Sprintf("%s-%d", sourceType, time.Now().UnixNano()),
+		Type:     sourceType,
+		URL:      strings.TrimSpace(sourceURL),
+		Schedule: schedule,
+		Options:  options,
+		Active:   active,
+	}
+	if err := validateSource(source); err != nil {
+		return nil, err
+	}
+	if err := validateSourcePath(source, i.cfg.Sources.AllowedPaths); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO knowledge_sources (id, type, url, schedule, options, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + sourceColumns
+
+	var created Source
+	err := i.db.GetContext(ctx, &created, query, source.ID, source.Type, source.URL, source.Schedule, source.Options, source.Active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert source: %w", err)
+	}
+
+	if err := i.scheduleSource(created); err != nil {
+		return nil, err
+	}
+	created.NextRun = i.nextRun(created.ID)
+
+	return &created, nil
+}
+
+// ListSources returns knowledge sources, newest first, optionally only
+// those in the dead letter state
+func (i *Ingester) ListSources(ctx context.Context, deadLettered bool) ([]Source, error) {
+	sources := []Source{}
+	query := `
+		SELECT ` + sourceColumns + `
+		FROM knowledge_sources
+		WHERE NOT $1 OR dead_lettered_at IS NOT NULL
+		ORDER BY created_at DESC`
+	if err := i.db.SelectContext(ctx, &sources, query, deadLettered); err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+
+	ids := make([]string, len(sources))
+	for idx := range sources {
+		sources[idx].NextRun = i.nextRun(sources[idx].ID)
+		ids[idx] = sources[idx].ID
+	}
+
+	entries, err := i.cacheEntries(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	cache := map[string][]CacheEntry{}
+	for _, entry := range entries {
+		cache[entry.SourceID] = append(cache[entry.SourceID], entry)
+	}
+	for idx := range sources {
+		sources[idx].Cache = cache[sources[idx].ID]
+	}
+
+	return sources, nil
+}
+
+// GetSource retrieves a knowledge source by its ID
+func (i *Ingester) GetSource(ctx context.Context, sourceID string) (*Source, error) {
+	var source Source
+	query := `SELECT ` + sourceColumns + ` FROM knowledge_sources WHERE id = $1`
+	if err := i.db.GetContext(ctx, &source, query, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to get source: %w", err)
+	}
+	source.NextRun = i.nextRun(source.ID)
+
+	cache, err := i.cacheEntries(ctx, source.ID)
+	if err != nil {
+		return nil, err
+	}
+	source.Cache = cache
+
+	return &source, nil
+}
+
+// UpdateSource changes the schedule, active flag and/or options of a source.
+// Reactivating an inactive source, such as a dead-lettered one, clears its
+// failure state; other updates keep it. Changing the options clears the
+// cached state of earlier runs so the next run re-reads the content.
+func (i *Ingester) UpdateSource(ctx context.Context, sourceID string, schedule *string, active *bool, options *SourceOptions) (*Source, error) {
+	source, err := i.GetSource(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule != nil {
+		source.Schedule = *schedule
+		if source.Schedule == "" {
+			source.Schedule = i.cfg.Sources.DefaultSchedule
+		}
+	}
+	reactivated := active != nil && *active && !source.Active
+	if active != nil {
+		source.Active = *active
+	}
+	optionsChanged := false
+	if options != nil {
+		options.restoreSecrets(source.Options)
+		optionsChanged = !reflect.DeepEqual(source.Options, *options)
+		source.Options = *options
+	}
+	if err := validateSource(*source); err != nil {
+		return nil, err
+	}
+	// The path is only checked when the update starts reading it again, so
+	// sources outside narrowed allowed paths can still be paused and
+	// rescheduled; runs check it too
+	if optionsChanged || reactivated {
+		if err := validateSourcePath(*source, i.cfg.Sources.AllowedPaths); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE knowledge_sources
+		SET schedule = $2,
+			active = $3,
+			options = $4,
+			consecutive_failures = CASE WHEN $5 THEN 0 ELSE consecutive_failures END,
+			dead_lettered_at = CASE WHEN $5 THEN NULL ELSE dead_lettered_at END,
+			dead_letter_reason = CASE WHEN $5 THEN '' ELSE dead_letter_reason END
+		WHERE id = $1
+		RETURNING ` + sourceColumns
+
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var updated Source
+	if err := tx.GetContext(ctx, &updated, query, sourceID, source.Schedule, source.Active, source.Options, reactivated); err != nil {
+		return nil, fmt.Errorf("failed to update source: %w", err)
+	}
+	if optionsChanged {
+		if err := clearSourceState(ctx, tx, sourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit source update: %w", err)
+	}
+
+	if err := i.scheduleSource(updated); err != nil {
+		return nil, err
+	}
+	updated.NextRun = i.nextRun(updated.ID)
+
+	return &updated, nil
+}
+
+// clearSourceState forgets what earlier runs remembered about a source's
+// content, such as HTTP validators, crawl progress, seen feed items, scanned
+// files and the last ingested commit, so that changed options apply on the next run instead of the
+// content being skipped as not modified
+func clearSourceState(ctx context.Context, tx *sqlx.Tx, sourceID string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM http_cache WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to clear cached validators: %w", err)
+	}
+	// A crawl in progress would otherwise continue with the old scope
+	if _, err := tx.ExecContext(ctx, `DELETE FROM crawl_state WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to clear crawl state: %w", err)
+	}
+	// Repositories are otherwise only diffed from the last commit, which
+	// misses files that changed include and exclude patterns now select
+	if _, err := tx.ExecContext(ctx, `DELETE FROM git_state WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to clear git state: %w", err)
+	}
+	// Seen feed items would never be fetched with the new options
+	if _, err := tx.ExecContext(ctx, `DELETE FROM feed_items WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to clear seen feed items: %w", err)
+	}
+	// Unchanged files would otherwise be skipped with the old options
+	if _, err := tx.ExecContext(ctx, `DELETE FROM directory_files WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to clear file states: %w", err)
+	}
+	return nil
+}
+
+// DeleteSource removes a knowledge source together with its documents
+func (i *Ingester) DeleteSource(ctx context.Context, sourceID string) error {
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM knowledge_base WHERE source_id = $1`, sourceID); err != nil {
+		return fmt.Errorf("failed to delete source documents: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM knowledge_sources WHERE id = $1`, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete source: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get deleted count: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete source: %w", sql.ErrNoRows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit source deletion: %w", err)
+	}
+
+	i.unscheduleSource(sourceID)
+
+	// Drop the mirror of a git source
+	if err := os.RemoveAll(filepath.Join(i.cfg.Sources.GitDir, sourceID)); err != nil {
+		log.Printf("Error removing repository mirror of %s: %v", sourceID, err)
+	}
+	return nil
+}
+
+// RefreshSource queues a run for a source to be processed in the background
+func (i *Ingester) RefreshSource(source Source) (*IngestionRun, error) {
+	return i.runSource(source, RunTriggerManual)
+}
+
+// createSourceHandler adds a knowledge source
+func createSourceHandler(w http.ResponseWriter, r *http.Request) {
+	var req SourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	schedule := ""
+	if req.Schedule != nil {
+		schedule = *req.Schedule
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	options := SourceOptions{}
+	if req.Options != nil {
+		options = *req.Options
+	}
+
+	source, err := ingester.AddSource(r.Context(), req.Type, req.URL, schedule, active, options)
+	if err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, source.redacted())
+}
+
+// listSourcesHandler returns all knowledge sources, or only dead-lettered
+// ones with ?dead_lettered=true
+func listSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	deadLettered, _ := strconv.ParseBool(r.URL.Query().Get("dead_lettered"))
+	sources, err := ingester.ListSources(r.Context(), deadLettered)
+	if err != nil {
+		log.Printf("Error listing sources: %v", err)
+		http.Error(w, "Failed to list sources", http.StatusInternalServerError)
+		return
+	}
+
+	for idx := range sources {
+		sources[idx] = sources[idx].redacted()
+	}
+	writeJSON(w, http.StatusOK, sources)
+}
+
+// getSourceHandler returns a single knowledge source
+func getSourceHandler(w http.ResponseWriter, r *http.Request) {
+	source, err := ingester.GetSource(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, source.redacted())
+}
+
+// updateSourceHandler changes a source's schedule or options, or
+// activates/deactivates it
+func updateSourceHandler(w http.ResponseWriter, r *http.Request) {
+	var req SourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Type != "" || req.URL != "" {
+		http.Error(w, "Source type and url cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	source, err := ingester.UpdateSource(r.Context(), r.PathValue("id"), req.Schedule, req.Active, req.Options)
+	if err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, source.redacted())
+}
+
+// deleteSourceHandler removes a source and its documents
+func deleteSourceHandler(w http.ResponseWriter, r *http.Request) {
+	if err := ingester.DeleteSource(r.Context(), r.PathValue("id")); err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshSourceHandler triggers an immediate refresh of a source
+func refreshSourceHandler(w http.ResponseWriter, r *http.Request) {
+	source, err := ingester.GetSource(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeSourceError(w, err)
+		return
+	}
+
+	run, err := ingester.RefreshSource(*source)
+	if errors.Is(err, errRunInProgress) {
+		http.Error(w, "Source is already being refreshed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error refreshing source %s: %v", source.ID, err)
+		http.Error(w, "Failed to refresh source", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// refreshAllSourcesHandler triggers a refresh of every active source
+func refreshAllSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	go ingester.processActiveSources(RunTriggerManual)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// writeSourceError maps source errors to 400, 404 or 500
+func writeSourceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidSource) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeLookupError(w, "source", err)
+}
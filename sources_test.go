@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSourcePath(t *testing.T) {
+	root := t.TempDir()
+	allowed := filepath.Join(root, "allowed")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{allowed, outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source Source
+		ok     bool
+	}{
+		{Source{Type: SourceTypeText, URL: filepath.Join(allowed, "notes.md")}, true},
+		{Source{Type: SourceTypePDF, URL: filepath.Join(allowed, "new", "handbook.pdf")}, true},
+		{Source{Type: SourceTypeText, URL: filepath.Join(outside, "notes.md")}, false},
+		{Source{Type: SourceTypeText, URL: filepath.Join(allowed, "..", "outside", "notes.md")}, false},
+		{Source{Type: SourceTypeText, URL: filepath.Join(allowed, "escape", "notes.md")}, false},
+		{Source{Type: SourceTypeText, URL: allowed + "-sibling/notes.md"}, false},
+		{Source{Type: SourceTypeText, URL: "/etc/passwd"}, false},
+		{Source{Type: SourceTypeDirectory, URL: filepath.Join(allowed, "team-docs")}, true},
+		{Source{Type: SourceTypeDirectory, URL: allowed}, true},
+		{Source{Type: SourceTypeDirectory, URL: root}, false},
+		{Source{Type: SourceTypeDirectory, URL: filepath.Join(allowed, "escape")}, false},
+		{Source{Type: SourceTypeGit, URL: filepath.Join(allowed, "project")}, true},
+		{Source{Type: SourceTypeGit, URL: "file://" + filepath.Join(allowed, "project")}, true},
+		{Source{Type: SourceTypeGit, URL: "file://" + filepath.Join(outside, "project")}, false},
+		{Source{Type: SourceTypeGit, URL: "https://github.com/example/project.git"}, true},
+		{Source{Type: SourceTypeText, URL: "https://example.com/notes.md"}, true},
+		{Source{Type: SourceTypeLink, URL: "https://example.com/"}, true},
+	}
+	for _, tt := range tests {
+		err := checkSourcePath(tt.source, []string{allowed})
+		if (err == nil) != tt.ok {
+			t.Errorf("checkSourcePath(%s %s) = %v, want allowed %v", tt.source.Type, tt.source.URL, err, tt.ok)
+		}
+	}
+
+	if err := checkSourcePath(Source{Type: SourceTypeText, URL: filepath.Join(allowed, "notes.md")}, nil); err == nil {
+		t.Error("local paths should be rejected without allowed paths")
+	}
+}
+
+func TestValidateSourcePath(t *testing.T) {
+	source := Source{Type: SourceTypeText, URL: "/etc/passwd", Schedule: "0 * * * *"}
+	if err := validateSource(source); err != nil {
+		t.Errorf("validateSource = %v, want the path left to validateSourcePath", err)
+	}
+	if err := validateSourcePath(source, []string{t.TempDir()}); !errors.Is(err, errInvalidSource) {
+		t.Errorf("err = %v, want errInvalidSource", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// uploadSourceID prefixes the IDs of uploaded documents, which belong to no
+// source
+const uploadSourceID = "upload"
+
+// UploadResult reports what became of one uploaded file
+type UploadResult struct {
+	Filename string `json:"filename,omitempty"`
+	DocID    string `json:"doc_id,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Chunks   int    `json:"chunks"`
+	Error    string `json:"error,omitempty"`
+}
+
+// uploadDocumentsHandler ingests the files of a multipart request, sent as
+// one or more "file" fields. Uploads are keyed by their bytes, so sending
+// the same file again leaves its document unchanged.
+func uploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	// Embedding large files can outlast the server's WriteTimeout, so the
+	// deadline is lifted and the upload bounded like a source run instead
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing write deadline: %v", err)
+	}
+	ctx, cancel := withRequestTimeout(r.Context(), time.Duration(ingester.cfg.Sources.TimeoutDuration))
+	defer cancel()
+
+	r.Body = http.MaxBytesReader(w, r.Body, ingester.cfg.Server.MaxRequestSize)
+	if err := r.ParseMultipartForm(ingester.cfg.Server.MaxRequestSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Upload exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		http.Error(w, `No files uploaded in the "file" field`, http.StatusBadRequest)
+		return
+	}
+
+	results := make([]UploadResult, 0, len(files))
+	succeeded := 0
+	for _, header := range files {
+		result := ingestUpload(ctx, header)
+		if result.Error == "" {
+			succeeded++
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusCreated
+	if succeeded == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, map[string]interface{}{"documents": results})
+}
+
+// ingestUpload extracts, embeds and stores one uploaded file
+func ingestUpload(ctx context.Context, header *multipart.FileHeader) UploadResult {
+	result := UploadResult{Filename: header.Filename}
+
+	f, err := header.Open()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	content, err := extractDocument(header.Filename, header.Header.Get("Content-Type"), data)
+	if err != nil {
+		log.Printf("Error extracting upload %s: %v", header.Filename, err)
+		result.Error = err.Error()
+		return result
+	}
+	// Uploads have no location to link to
+	content.URL = ""
+	content.Source = uploadSourceID
+	if content.Metadata == nil {
+		content.Metadata = Metadata{}
+	}
+	content.Metadata["filename"] = header.Filename
+
+	result.DocID = documentID(uploadSourceID, string(data))
+	result.Title = content.Title
+	result.Status, result.Chunks, err = db.IndexContent(ctx, result.DocID, content)
+	if err != nil {
+		log.Printf("Error indexing upload %s: %v", header.Filename, err)
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// TextDocumentRequest is the body of raw text document requests. ID makes
+// repeated posts update one document; without it the text identifies it.
+type TextDocumentRequest struct {
+	ID       string   `json:"id,omitempty"`
+	Title    string   `json:"title"`
+	Text     string   `json:"text"`
+	URL      string   `json:"url,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Metadata Metadata `json:"metadata,omitempty"`
+}
+
+// createTextDocumentHandler embeds and stores a document posted as JSON
+func createTextDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, ingester.cfg.Server.MaxRequestSize)
+
+	var req TextDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Title and text are required", http.StatusBadRequest)
+		return
+	}
+
+	content := Content{
+		Title:       req.Title,
+		Text:        strings.TrimSpace(req.Text),
+		Source:      uploadSourceID,
+		SourceType:  SourceTypeText,
+		URL:         req.URL,
+		PublishedAt: time.Now(),
+		Tags:        req.Tags,
+		Metadata:    req.Metadata,
+	}
+
+	key := req.ID
+	if key == "" {
+		key = req.Title + "\x00" + req.Text
+	}
+	result := UploadResult{DocID: documentID(uploadSourceID, key), Title: req.Title}
+
+	var err error
+	result.Status, result.Chunks, err = db.IndexContent(r.Context(), result.DocID, content)
+	if err != nil {
+		log.Printf("Error indexing text document %s: %v", req.Title, err)
+		http.Error(w, "Failed to index document", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, result)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Kinds of YouTube source targets
+const (
+	youtubeVideo    = "video"
+	youtubePlaylist = "playlist"
+	youtubeChannel  = "channel"
+	youtubeHandle   = "handle"
+)
+
+// Caption track kinds
+const (
+	captionManual = "manual"
+	captionASR    = "asr"
+)
+
+// transcriptParagraph is the length of transcript text, in seconds, that is
+// joined into one paragraph
+const transcriptParagraph = 30
+
+// errQuotaExhausted is returned once the daily YouTube quota is used up
+var errQuotaExhausted = errors.New("daily YouTube API quota exhausted")
+
+// YouTubeOptions narrow the ingestion of a YouTube source
+type YouTubeOptions struct {
+	// Languages overrides the configured caption language preference
+	Languages []string `json:"languages,omitempty"`
+	// MaxVideos limits the videos ingested from a channel or playlist,
+	// defaulting to youtube.maxResults
+	MaxVideos int `json:"max_videos,omitempty"`
+}
+
+// youtubeTarget is the video, playlist or channel a YouTube source points at
+type youtubeTarget struct {
+	kind string
+	id   string
+}
+
+var (
+	videoIDPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	channelIDPattern  = regexp.MustCompile(`^UC[A-Za-z0-9_-]{22}$`)
+	playlistIDPattern = regexp.MustCompile(`^(PL|UU|LL|FL|OL|RD)[A-Za-z0-9_-]{10,}$`)
+	handlePattern     = regexp.MustCompile(`^@[A-Za-z0-9._-]{3,30}$`)
+)
+
+// parseYouTubeTarget accepts video, playlist and channel IDs, @handles, and
+// youtube.com or youtu.be URLs of them
+func parseYouTubeTarget(s string) (youtubeTarget, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case videoIDPattern.MatchString(s):
+		return youtubeTarget{youtubeVideo, s}, nil
+	case channelIDPattern.MatchString(s):
+		return youtubeTarget{youtubeChannel, s}, nil
+	case playlistIDPattern.MatchString(s):
+		return youtubeTarget{youtubePlaylist, s}, nil
+	case handlePattern.MatchString(s):
+		return youtubeTarget{youtubeHandle, s}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return youtubeTarget{}, fmt.Errorf("%q is not a YouTube video, playlist or channel", s)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	if host == "youtu.be" && videoIDPattern.MatchString(parts[0]) {
+		return youtubeTarget{youtubeVideo, parts[0]}, nil
+	}
+	if host == "youtube.com" || host == "m.youtube.com" || host == "music.youtube.com" {
+		query := u.Query()
+		switch {
+		case parts[0] == "watch" && videoIDPattern.MatchString(query.Get("v")):
+			return youtubeTarget{youtubeVideo, query.Get("v")}, nil
+		case parts[0] == "playlist" && query.Get("list") != "":
+			return youtubeTarget{youtubePlaylist, query.Get("list")}, nil
+		case len(parts) == 2 && (parts[0] == "shorts" || parts[0] == "embed" || parts[0] == "live") && videoIDPattern.MatchString(parts[1]):
+			return youtubeTarget{youtubeVideo, parts[1]}, nil
+		case len(parts) >= 2 && parts[0] == "channel" && channelIDPattern.MatchString(parts[1]):
+			return youtubeTarget{youtubeChannel, parts[1]}, nil
+		case handlePattern.MatchString(parts[0]):
+			return youtubeTarget{youtubeHandle, parts[0]}, nil
+		}
+	}
+	return youtubeTarget{}, fmt.Errorf("%q is not a YouTube video, playlist or channel", s)
+}
+
+// watchURL links to a video, optionally at a number of seconds in
+func watchURL(videoID string, seconds int) string {
+	if seconds > 0 {
+		return fmt.Sprintf("https://www.youtube.com/watch?v=%s&t=%ds", videoID, seconds)
+	}
+	return fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+}
+
+// youtubeQuota counts the Data API units spent per Pacific day, the period
+// after which YouTube resets quotas. The count restarts with the process.
+type youtubeQuota struct {
+	mu    sync.Mutex
+	limit int
+	day   string
+	used  int
+}
+
+// spend reserves units of quota. A zero limit disables the check.
+func (q *youtubeQuota) spend(units int) error {
+	if q == nil || q.limit <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := time.Now().In(pacific).Format(time.DateOnly)
+	if day != q.day {
+		q.day = day
+		q.used = 0
+	}
+	if q.used+units > q.limit {
+		return permanent(fmt.Errorf("%w: %d of %d units used", errQuotaExhausted, q.used, q.limit))
+	}
+	q.used += units
+	return nil
+}
+
+// pacific is the time zone of YouTube quota resets
+var pacific = func() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return location
+}()
+
+// videoIDs resolves a target to the IDs of at most limit videos
+func (p *YouTubeProcessor) videoIDs(ctx context.Context, target youtubeTarget, limit int) ([]string, error) {
+	switch target.kind {
+	case youtubeVideo:
+		return []string{target.id}, nil
+	case youtubePlaylist:
+		return p.playlistVideos(ctx, target.id, limit)
+	}
+
+	if err := p.quota.spend(1); err != nil {
+		return nil, err
+	}
+	call := p.service.Channels.List([]string{"contentDetails"}).Context(ctx)
+	if target.kind == youtubeHandle {
+		call = call.ForHandle(target.id)
+	} else {
+		call = call.Id(target.id)
+	}
+	response, err := call.Do()
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Items) == 0 || response.Items[0].ContentDetails == nil ||
+		response.Items[0].ContentDetails.RelatedPlaylists == nil {
+		return nil, permanent(fmt.Errorf("channel not found"))
+	}
+
+	return p.playlistVideos(ctx, response.Items[0].ContentDetails.RelatedPlaylists.Uploads, limit)
+}
+
+// playlistVideos lists the IDs of at most limit videos in a playlist
+func (p *YouTubeProcessor) playlistVideos(ctx context.Context, playlistID string, limit int) ([]string, error) {
+	var ids []string
+	pageToken := ""
+	for len(ids) < limit {
+		if err := p.quota.spend(1); err != nil {
+			return nil, err
+		}
+		call := p.service.PlaylistItems.List([]string{"contentDetails"}).
+			PlaylistId(playlistID).
+			MaxResults(int64(min(limit-len(ids), 50))).
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		response, err := call.Do()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range response.Items {
+			if item.ContentDetails != nil && len(ids) < limit {
+				ids = append(ids, item.ContentDetails.VideoId)
+			}
+		}
+		pageToken = response.NextPageToken
+		if pageToken == "" {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// videos fetches the snippets of videos, 50 per request
+func (p *YouTubeProcessor) videos(ctx context.Context, ids []string) ([]*youtube.Video, error) {
+	var videos []*youtube.Video
+	for start := 0; start < len(ids); start += 50 {
+		if err := p.quota.spend(1); err != nil {
+			return nil, err
+		}
+		end := min(start+50, len(ids))
+		response, err := p.service.Videos.List([]string{"snippet"}).Id(ids[start:end]...).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, response.Items...)
+	}
+	return videos, nil
+}
+
+// captionTrack is a caption track listed by the timedtext endpoint
+type captionTrack struct {
+	Name     string `xml:"name,attr"`
+	Language string `xml:"lang_code,attr"`
+	Kind     string `xml:"kind,attr"`
+	Default  bool   `xml:"lang_default,attr"`
+}
+
+// transcriptSegment is one timed caption line
+type transcriptSegment struct {
+	Start    float64 `xml:"start,attr"`
+	Duration float64 `xml:"dur,attr"`
+	Text     string  `xml:",chardata"`
+}
+
+// captionTracks lists the caption tracks of a video
+func (p *YouTubeProcessor) captionTracks(ctx context.Context, videoID string) ([]captionTrack, error) {
+	query := url.Values{"type": {"list"}, "v": {videoID}}
+	var list struct {
+		Tracks []captionTrack `xml:"track"`
+	}
+	if err := p.getTimedText(ctx, query, &list); err != nil {
+		return nil, fmt.Errorf("failed to list caption tracks: %w", err)
+	}
+	return list.Tracks, nil
+}
+
+// transcript fetches the segments of a caption track
+func (p *YouTubeProcessor) transcript(ctx context.Context, videoID string, track captionTrack) ([]transcriptSegment, error) {
+	query := url.Values{"v": {videoID}, "lang": {track.Language}, "name": {track.Name}}
+	if track.Kind != "" {
+		query.Set("kind", track.Kind)
+	}
+	var transcript struct {
+		Segments []transcriptSegment `xml:"text"`
+	}
+	if err := p.getTimedText(ctx, query, &transcript); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s captions: %w", track.Language, err)
+	}
+	return transcript.Segments, nil
+}
+
+// getTimedText decodes an XML response of the timedtext endpoint. An empty
+// body, which YouTube sends for videos without captions, decodes to nothing.
+func (p *YouTubeProcessor) getTimedText(ctx context.Context, query url.Values, v interface{}) error {
+	resp, err := getURL(ctx, p.client, p.timedTextURL+"?"+query.Encode(), nil)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = xml.NewDecoder(resp.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return permanent(fmt.Errorf("failed to decode timedtext response: %w", err))
+	}
+	return nil
+}
+
+// chooseTrack picks a caption track by language preference, preferring
+// manual captions over automatic ones in every language. Without a match
+// the default or first track is used.
+func chooseTrack(tracks []captionTrack, languages []string) (captionTrack, bool) {
+	if len(tracks) == 0 {
+		return captionTrack{}, false
+	}
+	for _, auto := range []bool{false, true} {
+		for _, language := range languages {
+			for _, track := range tracks {
+				if (track.Kind == captionASR) == auto && sameLanguage(track.Language, language) {
+					return track, true
+				}
+			}
+		}
+	}
+	for _, track := range tracks {
+		if track.Default && track.Kind != captionASR {
+			return track, true
+		}
+	}
+	for _, track := range tracks {
+		if track.Kind != captionASR {
+			return track, true
+		}
+	}
+	return tracks[0], true
+}
+
+// sameLanguage compares language tags by their primary language, so "en-GB"
+// matches "en"
+func sameLanguage(a, b string) bool {
+	primary := func(tag string) string {
+		tag, _, _ = strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+		return strings.ToLower(tag)
+	}
+	return primary(a) == primary(b)
+}
+
+// transcriptText appends caption segments to prefix in paragraphs and
+// returns a location linking to the video at each segment
+func transcriptText(videoID, prefix string, segments []transcriptSegment) (string, []Location) {
+	var text strings.Builder
+	text.WriteString(prefix)
+	length := utf8.RuneCountInString(prefix)
+
+	var locations []Location
+	paragraphStart := -1.0
+	for _, segment := range segments {
+		line := strings.Join(strings.Fields(html.UnescapeString(segment.Text)), " ")
+		if line == "" {
+			continue
+		}
+
+		separator := " "
+		if paragraphStart < 0 || segment.Start-paragraphStart >= transcriptParagraph {
+			separator = "\n\n"
+			paragraphStart = segment.Start
+		}
+		if length > 0 {
+			text.WriteString(separator)
+			length += len(separator)
+		}
+
+		seconds := int(segment.Start)
+		locations = append(locations, Location{
+			Offset: length,
+			Label:  formatTimestamp(seconds),
+			URL:    watchURL(videoID, seconds),
+		})
+		text.WriteString(line)
+		length += utf8.RuneCountInString(line)
+	}
+	return text.String(), locations
+}
+
+// formatTimestamp formats seconds as m:ss or h:mm:ss
+func formatTimestamp(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
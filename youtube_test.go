@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammedrefaat/smart-ai-assistant/config"
+)
+
+func TestParseYouTubeTarget(t *testing.T) {
+	tests := []struct {
+		source string
+		want   youtubeTarget
+	}{
+		{"dQw4w9WgXcQ", youtubeTarget{youtubeVideo, "dQw4w9WgXcQ"}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", youtubeTarget{youtubeVideo, "dQw4w9WgXcQ"}},
+		{"https://youtu.be/dQw4w9WgXcQ", youtubeTarget{youtubeVideo, "dQw4w9WgXcQ"}},
+		{"https://m.youtube.com/shorts/dQw4w9WgXcQ", youtubeTarget{youtubeVideo, "dQw4w9WgXcQ"}},
+		{"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", youtubeTarget{youtubePlaylist, "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"}},
+		{"PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", youtubeTarget{youtubePlaylist, "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"}},
+		{"UC_x5XG1OV2P6uZZ5FSM9Ttw", youtubeTarget{youtubeChannel, "UC_x5XG1OV2P6uZZ5FSM9Ttw"}},
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw/videos", youtubeTarget{youtubeChannel, "UC_x5XG1OV2P6uZZ5FSM9Ttw"}},
+		{"@GoogleDevelopers", youtubeTarget{youtubeHandle, "@GoogleDevelopers"}},
+		{"https://www.youtube.com/@GoogleDevelopers/videos", youtubeTarget{youtubeHandle, "@GoogleDevelopers"}},
+	}
+	for _, tt := range tests {
+		got, err := parseYouTubeTarget(tt.source)
+		if err != nil || got != tt.want {
+			t.Errorf("parseYouTubeTarget(%s) = %v, %v; want %v", tt.source, got, err, tt.want)
+		}
+	}
+
+	for _, source := range []string{"", "not a video", "https://vimeo.com/12345", "https://www.youtube.com/watch?v=short", "ftp://youtu.be/dQw4w9WgXcQ"} {
+		if _, err := parseYouTubeTarget(source); err == nil {
+			t.Errorf("parseYouTubeTarget(%q) should fail", source)
+		}
+	}
+}
+
+func TestChooseTrack(t *testing.T) {
+	tracks := []captionTrack{
+		{Name: "auto", Language: "en", Kind: captionASR},
+		{Name: "german", Language: "de", Default: true},
+		{Name: "british", Language: "en-GB"},
+		{Name: "french auto", Language: "fr", Kind: captionASR},
+	}
+
+	tests := []struct {
+		languages []string
+		want      string
+	}{
+		{[]string{"en"}, "british"},
+		{[]string{"fr", "en"}, "british"},
+		{[]string{"fr"}, "french auto"},
+		{[]string{"es"}, "german"},
+		{nil, "german"},
+	}
+	for _, tt := range tests {
+		track, ok := chooseTrack(tracks, tt.languages)
+		if !ok || track.Name != tt.want {
+			t.Errorf("chooseTrack(%v) = %q, want %q", tt.languages, track.Name, tt.want)
+		}
+	}
+
+	if track, ok := chooseTrack(tracks[:1], []string{"de"}); !ok || track.Name != "auto" {
+		t.Errorf("chooseTrack with only automatic captions = %q, want them", track.Name)
+	}
+	if _, ok := chooseTrack(nil, []string{"en"}); ok {
+		t.Error("chooseTrack without tracks should find nothing")
+	}
+}
+
+func TestTranscriptText(t *testing.T) {
+	segments := []transcriptSegment{
+		{Start: 0.5, Text: "Welcome &amp; hello"},
+		{Start: 4, Text: "  to the\nshow "},
+		{Start: 12, Text: " "},
+		{Start: 31, Text: "Second part"},
+		{Start: 3725, Text: "Much later"},
+	}
+	text, locations := transcriptText("dQw4w9WgXcQ", "Intro text", segments)
+
+	want := "Intro text\n\nWelcome & hello to the show\n\nSecond part\n\nMuch later"
+	if text != want {
+		t.Fatalf("text = %q, want %q", text, want)
+	}
+
+	wantLocations := []struct {
+		line  string
+		label string
+		url   string
+	}{
+		{"Welcome", "0:00", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"to the show", "0:04", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=4s"},
+		{"Second part", "0:31", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=31s"},
+		{"Much later", "1:02:05", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=3725s"},
+	}
+	if len(locations) != len(wantLocations) {
+		t.Fatalf("got %d locations, want %d", len(locations), len(wantLocations))
+	}
+	for i, want := range wantLocations {
+		got := locations[i]
+		if !strings.HasPrefix(text[got.Offset:], want.line) || got.Label != want.label || got.URL != want.url {
+			t.Errorf("location %d = %+v at %q, want %q, %q at %q", i, got, text[got.Offset:], want.label, want.url, want.line)
+		}
+	}
+}
+
+// youtubeStub serves the Data API and timedtext endpoints for a channel with
+// a number of uploaded videos
+type youtubeStub struct {
+	videos int
+	// failCaptions is a video whose caption track list can't be fetched
+	failCaptions string
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func videoID(n int) string {
+	return fmt.Sprintf("video%06d", n)
+}
+
+func (s *youtubeStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	s.mu.Unlock()
+
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case "/youtube/v3/channels":
+		fmt.Fprint(w, `{"items": [{"contentDetails": {"relatedPlaylists": {"uploads": "UUuploads"}}}]}`)
+	case "/youtube/v3/playlistItems":
+		// Two videos per page at most, whatever maxResults asks for
+		start := 0
+		fmt.Sscan(query.Get("pageToken"), &start)
+		var items []string
+		for n := start; n < min(start+2, s.videos); n++ {
+			items = append(items, fmt.Sprintf(`{"contentDetails": {"videoId": %q}}`, videoID(n)))
+		}
+		next := ""
+		if start+2 < s.videos {
+			next = fmt.Sprint(start + 2)
+		}
+		fmt.Fprintf(w, `{"items": [%s], "nextPageToken": %q}`, strings.Join(items, ","), next)
+	case "/youtube/v3/videos":
+		var items []string
+		for _, ids := range query["id"] {
+			for _, id := range strings.Split(ids, ",") {
+				items = append(items, fmt.Sprintf(`{"id": %q, "snippet": {"title": "Video %s", "description": "About %s", "publishedAt": "2024-05-01T10:00:00Z"}}`, id, id, id))
+			}
+		}
+		fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+	case "/timedtext":
+		switch {
+		case query.Get("v") == s.failCaptions:
+			w.WriteHeader(http.StatusForbidden)
+		case query.Get("type") == "list":
+			fmt.Fprint(w, `<transcript_list><track name="" lang_code="en" lang_default="true"/></transcript_list>`)
+		default:
+			fmt.Fprint(w, `<transcript><text start="0" dur="2">Hello</text><text start="42.5" dur="2">there</text></transcript>`)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newYouTubeStub(t *testing.T, stub *youtubeStub, quota int) *YouTubeProcessor {
+	t.Helper()
+	stub.requests = map[string]int{}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	processor, err := NewYouTubeProcessor(config.YouTubeConfig{
+		APIKey:         "key",
+		MaxResults:     50,
+		QuotaPerDay:    quota,
+		RequestTimeout: config.Duration(5 * time.Second),
+		BaseURL:        server.URL + "/",
+		TimedTextURL:   server.URL + "/timedtext",
+		Languages:      []string{"en"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create processor: %v", err)
+	}
+	return processor
+}
+
+func TestYouTubeProcessorChannel(t *testing.T) {
+	stub := &youtubeStub{videos: 7, failCaptions: videoID(1)}
+	processor := newYouTubeStub(t, stub, 0)
+
+	contents, complete, err := processor.Fetch(context.Background(), "@GoogleDevelopers", YouTubeOptions{MaxVideos: 5})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if complete {
+		t.Error("a channel fetch should never be complete")
+	}
+	if len(contents) != 5 {
+		t.Fatalf("got %d videos, want max_videos of them", len(contents))
+	}
+	if pages := stub.requests["/youtube/v3/playlistItems"]; pages != 3 {
+		t.Errorf("listed %d playlist pages, want 3", pages)
+	}
+
+	for n, content := range contents {
+		if content.ID != videoID(n) {
+			t.Errorf("video %d has ID %q", n, content.ID)
+		}
+		if n == 1 {
+			if content.Err == nil || content.URL != watchURL(videoID(n), 0) {
+				t.Errorf("video with failing captions: err = %v, URL = %q; want an error and the video URL", content.Err, content.URL)
+			}
+			continue
+		}
+		if content.Err != nil {
+			t.Errorf("video %d failed: %v", n, content.Err)
+		}
+		if !strings.HasSuffix(content.Text, "Transcript:\n\nHello\n\nthere") || len(content.Locations) != 2 {
+			t.Errorf("video %d text = %q", n, content.Text)
+		}
+		if url := content.Locations[1].URL; url != watchURL(videoID(n), 42) {
+			t.Errorf("video %d location URL = %q", n, url)
+		}
+	}
+}
+
+func TestYouTubeProcessorVideo(t *testing.T) {
+	stub := &youtubeStub{videos: 1, failCaptions: videoID(9)}
+	processor := newYouTubeStub(t, stub, 0)
+
+	contents, complete, err := processor.Fetch(context.Background(), "https://youtu.be/"+videoID(0), YouTubeOptions{})
+	if err != nil || !complete || len(contents) != 1 {
+		t.Fatalf("Fetch = %d videos, complete = %v, err = %v; want the one video", len(contents), complete, err)
+	}
+	if contents[0].Title != "Video "+videoID(0) || contents[0].Metadata["caption_language"] != "en" {
+		t.Errorf("video = %q, metadata %v", contents[0].Title, contents[0].Metadata)
+	}
+
+	// A single video fails as a whole
+	_, _, err = processor.Fetch(context.Background(), videoID(9), YouTubeOptions{})
+	if err == nil {
+		t.Error("Fetch of a video with failing captions should fail")
+	}
+}
+
+func TestYouTubeProcessorQuota(t *testing.T) {
+	// A channel lookup, two playlist pages and a video list cost 4 units
+	stub := &youtubeStub{videos: 4}
+	processor := newYouTubeStub(t, stub, 6)
+
+	if _, _, err := processor.Fetch(context.Background(), "UC_x5XG1OV2P6uZZ5FSM9Ttw", YouTubeOptions{}); err != nil {
+		t.Fatalf("first fetch failed: %v", err)
+	}
+
+	_, _, err := processor.Fetch(context.Background(), "UC_x5XG1OV2P6uZZ5FSM9Ttw", YouTubeOptions{})
+	if !errors.Is(err, errQuotaExhausted) || isTransient(err) {
+		t.Errorf("second fetch err = %v, want a permanent quota error", err)
+	}
+	if lists := stub.requests["/youtube/v3/playlistItems"]; lists != 3 {
+		t.Errorf("listed %d playlist pages, want the quota to stop the third fetch", lists)
+	}
+}